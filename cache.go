@@ -0,0 +1,110 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// renderCache caches the rendered documentation of packages.
+// A cached page is valid so long as the package tree is unchanged and
+// none of the source files that the page was rendered from are modified.
+type renderCache struct {
+	mu    sync.Mutex
+	pages map[string]*renderedPage // keyed by import path
+}
+
+// renderedPage is the rendered documentation for a package.
+type renderedPage struct {
+	cfg     *renderConfig // configuration the page was rendered with
+	stamp   string        // modification times and sizes of the source files
+	modTime time.Time     // time the content was last changed
+	etag    string        // entity tag derived from the rendered content
+	data    []byte
+}
+
+// render returns the rendered documentation for pkg,
+// rendering it only if there is no valid cached page.
+func (c *renderCache) render(pkg *packageInfo, cfg *renderConfig) (*renderedPage, error) {
+	stamp := cfg.stampInputs(pkg)
+	c.mu.Lock()
+	prev := c.pages[pkg.impPath]
+	c.mu.Unlock()
+	if prev != nil && prev.cfg == cfg && prev.stamp == stamp {
+		return prev, nil
+	}
+
+	var bb bytes.Buffer
+	if err := pkg.renderHTML(&bb, cfg); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(bb.Bytes())
+	page := &renderedPage{
+		cfg:     cfg,
+		stamp:   stamp,
+		modTime: time.Now().Truncate(time.Second),
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		data:    bb.Bytes(),
+	}
+
+	// The page depends on more than its source files (e.g., the package tree),
+	// so it is only known to be modified if its content changed.
+	// Since Last-Modified has a resolution of a second,
+	// ensure that it increases whenever the content changes.
+	if prev != nil {
+		if prev.etag == page.etag {
+			page.modTime = prev.modTime
+		} else if !page.modTime.After(prev.modTime) {
+			page.modTime = prev.modTime.Add(time.Second)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pages == nil {
+		c.pages = make(map[string]*renderedPage)
+	}
+	c.pages[pkg.impPath] = page
+	return page, nil
+}
+
+// ServeHTTP serves the page, responding to conditional requests
+// based on its entity tag and modification time.
+func (page *renderedPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache") // always revalidate
+	w.Header().Set("ETag", page.etag)
+	http.ServeContent(w, r, "", page.modTime, bytes.NewReader(page.data))
+}
+
+// stampInputs returns the modification time and size of every source file
+// that the rendered documentation of pkg depends on.
+func (cfg *renderConfig) stampInputs(pkg *packageInfo) (stamp string) {
+	if !cfg.documented(pkg) {
+		return ""
+	}
+	pkgs := append([]*packageInfo{pkg}, cfg.related(pkg)...)
+	var bb bytes.Buffer
+	for _, pkg := range pkgs {
+		for _, name := range pkg.files {
+			name = filepath.Join(pkg.dirPath, name)
+			fi, err := os.Stat(name)
+			if err != nil {
+				fmt.Fprintf(&bb, "%s: %v\n", name, err)
+				continue
+			}
+			fmt.Fprintf(&bb, "%s: %d %d\n", name, fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+	return bb.String()
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte("// Package p is a package.\npackage p\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	root := new(packageInfo)
+	root.merge(&packageInfo{name: "p", impPath: "p", dirPath: dir, files: []string{"p.go"}})
+	cfg := &renderConfig{root: root}
+
+	var cache renderCache
+	render := func(cfg *renderConfig) *renderedPage {
+		t.Helper()
+		page, err := cache.render(cfg.root.resolve("p"), cfg)
+		if err != nil {
+			t.Fatalf("render error: %v", err)
+		}
+		return page
+	}
+	get := func(page *renderedPage, header http.Header) int {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/p", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		page.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	page1 := render(cfg)
+	if page2 := render(cfg); page2 != page1 {
+		t.Errorf("render of an unmodified package did not return the cached page")
+	}
+	lastModified := page1.modTime.UTC().Format(http.TimeFormat)
+	for _, tt := range []struct {
+		header http.Header
+		want   int
+	}{
+		{nil, http.StatusOK},
+		{http.Header{"If-None-Match": {page1.etag}}, http.StatusNotModified},
+		{http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+		{http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+	} {
+		if got := get(page1, tt.header); got != tt.want {
+			t.Errorf("GET with %v = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+
+	// Reloading an unchanged package tree does not modify the page.
+	cfg = &renderConfig{root: root.clone()}
+	page2 := render(cfg)
+	if page2 == page1 {
+		t.Errorf("render with a reloaded package tree returned the cached page")
+	}
+	if page2.etag != page1.etag || !page2.modTime.Equal(page1.modTime) {
+		t.Errorf("render of an unchanged page modified the ETag or modification time")
+	}
+	if got := get(page2, http.Header{"If-Modified-Since": {lastModified}}); got != http.StatusNotModified {
+		t.Errorf("GET of unchanged page with If-Modified-Since = %d, want %d", got, http.StatusNotModified)
+	}
+
+	// A new subpackage modifies the page without modifying its source files.
+	root = root.clone()
+	root.merge(&packageInfo{name: "sub", impPath: "p/sub", dirPath: filepath.Join(dir, "sub")})
+	cfg = &renderConfig{root: root}
+	page3 := render(cfg)
+	if page3.etag == page2.etag {
+		t.Errorf("render with a new subpackage did not modify the page")
+	}
+	if !page3.modTime.After(page2.modTime) {
+		t.Errorf("render with a new subpackage did not advance the modification time")
+	}
+	for _, header := range []http.Header{
+		{"If-None-Match": {page2.etag}},
+		{"If-Modified-Since": {lastModified}},
+	} {
+		if got := get(page3, header); got != http.StatusOK {
+			t.Errorf("GET of modified page with %v = %d, want %d", header, got, http.StatusOK)
+		}
+	}
+}
@@ -20,3 +20,9 @@ var styleCSS []byte
 
 //go:embed static/html/index.html
 var indexHTML string
+
+//go:embed static/html/search.html
+var searchHTML string
+
+//go:embed static/html/source.html
+var sourceHTML string
@@ -0,0 +1,311 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// manifestName is the name of the manifest in the generated output.
+const manifestName = "manifest.json"
+
+// manifest records a hash of the inputs of every page in the generated output.
+type manifest struct {
+	// Version identifies the godoc binary and the configuration
+	// that the pages were rendered with.
+	Version string
+	// Pages is the hash of the inputs of every page, keyed by file name.
+	// It also includes other generated files (e.g., "sitemap.xml").
+	Pages map[string]string
+}
+
+// pageRenderer renders the pages of packages for the generated output.
+// If there is a previous output, then pages whose inputs are unchanged
+// since the previous output was generated are copied from it.
+type pageRenderer struct {
+	cfg     *renderConfig
+	version string
+	prev    outputReader // may be nil
+	prevMan manifest
+
+	mu         sync.Mutex
+	fileHashes map[string]string // hash of each source file, keyed by path
+	pageHashes map[string]string // hash of inputs of each page, keyed by file name
+	reused     map[string]bool   // packages whose pages were reused, keyed by import path
+}
+
+// newPageRenderer returns a renderer for the pages of packages,
+// reusing unchanged pages from the previous output if non-nil.
+func newPageRenderer(cfg *renderConfig, prev outputReader) *pageRenderer {
+	r := &pageRenderer{
+		cfg:        cfg,
+		version:    cfg.version(),
+		prev:       prev,
+		fileHashes: make(map[string]string),
+		pageHashes: make(map[string]string),
+		reused:     make(map[string]bool),
+	}
+	if prev != nil {
+		b, err := prev.ReadFile(manifestName)
+		if err == nil {
+			err = json.Unmarshal(b, &r.prevMan)
+		}
+		switch {
+		case err != nil:
+			log.Printf("unable to read previous manifest, rendering all packages: %v", err)
+		case r.prevMan.Version != r.version:
+			log.Printf("previous output was generated by a different version or configuration, rendering all packages")
+		}
+	}
+	return r
+}
+
+// renderedFile is a file rendered for a package.
+type renderedFile struct {
+	name string // e.g., "archive/tar/index.html" or "archive/tar/reader.go.html"
+	data []byte
+}
+
+// render returns the rendered pages for pkg, which are the package page
+// and, if pkg is documented, the page for every source file.
+func (r *pageRenderer) render(pkg *packageInfo) []renderedFile {
+	files := []renderedFile{r.renderPackage(pkg)}
+	if r.cfg.documented(pkg) {
+		for _, name := range pkg.files {
+			files = append(files, r.renderSource(pkg, name))
+		}
+	}
+	return files
+}
+
+// renderPackage returns the rendered package page for pkg.
+func (r *pageRenderer) renderPackage(pkg *packageInfo) renderedFile {
+	name := path.Join(pkg.impPath, "index.html")
+	if b, ok := r.reuse(name, r.inputHash(pkg)); ok {
+		log.Printf("reusing %q", pkg.impPath)
+		r.mu.Lock()
+		r.reused[pkg.impPath] = true
+		r.mu.Unlock()
+		return renderedFile{name, b}
+	}
+
+	log.Printf("rendering %q", pkg.impPath)
+	var bb bytes.Buffer
+	if err := pkg.renderHTML(&bb, r.cfg); err != nil {
+		log.Fatalf("packageInfo.renderHTML error: %v", err)
+	}
+	return renderedFile{name, bb.Bytes()}
+}
+
+// renderSource returns the rendered page for the named source file in pkg,
+// which only depends on the contents of the file.
+func (r *pageRenderer) renderSource(pkg *packageInfo, file string) renderedFile {
+	name := path.Join(pkg.impPath, file+".html")
+	h := sha256.New()
+	fmt.Fprintf(h, "source %q %s\n", name, r.fileHash(filepath.Join(pkg.dirPath, file)))
+	if b, ok := r.reuse(name, hex.EncodeToString(h.Sum(nil))); ok {
+		return renderedFile{name, b}
+	}
+
+	var bb bytes.Buffer
+	if err := pkg.renderSourceHTML(&bb, r.cfg, file); err != nil {
+		log.Fatalf("packageInfo.renderSourceHTML error: %v", err)
+	}
+	return renderedFile{name, bb.Bytes()}
+}
+
+// reuse records the hash of the inputs of the named file and returns
+// the file from the previous output if its inputs are unchanged.
+func (r *pageRenderer) reuse(name, hash string) ([]byte, bool) {
+	r.mu.Lock()
+	r.pageHashes[name] = hash
+	r.mu.Unlock()
+	if r.prev == nil || r.prevMan.Version != r.version || r.prevMan.Pages[name] != hash {
+		return nil, false
+	}
+	b, err := r.prev.ReadFile(name)
+	return b, err == nil
+}
+
+// sitemap returns the sitemap for the pages of pkgs (see renderConfig.sitemap).
+func (r *pageRenderer) sitemap(siteURL string, pkgs []*packageInfo) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "site %q\n", siteURL)
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "package %q\n", pkg.impPath)
+	}
+	if b, ok := r.reuse("sitemap.xml", hex.EncodeToString(h.Sum(nil))); ok {
+		return b
+	}
+	return r.cfg.sitemap(siteURL, pkgs)
+}
+
+// searchEntries returns the search entries for the documented packages
+// among pkgs. The entries of packages whose pages were reused are copied
+// from the search index of the previous output instead of being computed,
+// since they depend on a subset of the inputs of the page.
+// It must be called after the pages of pkgs are rendered.
+func (r *pageRenderer) searchEntries(pkgs []*packageInfo) []searchEntry {
+	prevEntries := make(map[string][]searchEntry)
+	if len(r.reused) > 0 {
+		var index []searchIndexEntry
+		b, err := r.prev.ReadFile(searchIndexName)
+		if err == nil {
+			index, err = parseSearchIndex(b)
+		}
+		if err != nil {
+			log.Printf("unable to read previous search index, indexing all packages: %v", err)
+		}
+		for _, e := range index {
+			prevEntries[e.Path] = append(prevEntries[e.Path], e.searchEntry)
+		}
+	}
+
+	var entries []searchEntry
+	for _, pkg := range pkgs {
+		if len(pkg.files) == 0 || !r.cfg.documented(pkg) {
+			continue
+		}
+		if prev, ok := prevEntries[pkg.impPath]; ok && r.reused[pkg.impPath] {
+			entries = append(entries, prev...)
+		} else {
+			entries = append(entries, pkg.searchEntries()...)
+		}
+	}
+	return entries
+}
+
+// manifest returns the manifest for all pages rendered so far.
+func (r *pageRenderer) manifest() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(manifest{r.version, r.pageHashes}, "", "\t")
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return append(b, '\n')
+}
+
+// inputHash returns a hash of everything that the rendered page for pkg
+// depends on, other than the godoc binary and its configuration.
+func (r *pageRenderer) inputHash(pkg *packageInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "package %q\n", pkg.impPath)
+	if r.cfg.documented(pkg) {
+		if m := pkg.module; m != nil {
+			fmt.Fprintf(h, "module %q %q\n", m.Path, m.Version)
+		}
+		fmt.Fprintf(h, "error %q\n", pkg.err)
+		r.hashFiles(h, pkg)
+		if run := r.cfg.examples.run(r.cfg, pkg); run != nil {
+			fmt.Fprintf(h, "examples %q %v\n", run.err, run.results)
+		}
+
+		// Links to other packages depend on whether they are documented.
+		for _, impPath := range append(mergeStrings(pkg.imports, pkg.testImports), "builtin") {
+			fmt.Fprintf(h, "link %q %q\n", impPath, r.cfg.packageURL(pkg.impPath, impPath))
+		}
+		for _, rel := range r.cfg.related(pkg) {
+			fmt.Fprintf(h, "related %q\n", rel.impPath)
+			r.hashFiles(h, rel)
+		}
+	}
+	if pkg == r.cfg.root {
+		fmt.Fprintf(h, "index %q\n", r.cfg.packageIndex())
+	}
+	var subDirs []string
+	for dir, subPkg := range pkg.packages {
+		if r.cfg.visible(subPkg) {
+			subDirs = append(subDirs, dir)
+		}
+	}
+	sort.Strings(subDirs)
+	for _, dir := range subDirs {
+		fmt.Fprintf(h, "subdir %q\n", dir)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFiles writes the name, content hash, and platforms
+// of every source file in pkg to h.
+func (r *pageRenderer) hashFiles(h hash.Hash, pkg *packageInfo) {
+	for _, name := range pkg.files {
+		fmt.Fprintf(h, "file %q %s %q\n", name, r.fileHash(filepath.Join(pkg.dirPath, name)), pkg.platforms[name])
+	}
+}
+
+// fileHash returns a hash of the contents of the named file.
+func (r *pageRenderer) fileHash(name string) string {
+	r.mu.Lock()
+	sum, ok := r.fileHashes[name]
+	r.mu.Unlock()
+	if ok {
+		return sum
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		sum = "error: " + err.Error()
+	} else {
+		s := sha256.Sum256(b)
+		sum = hex.EncodeToString(s[:])
+	}
+	r.mu.Lock()
+	r.fileHashes[name] = sum
+	r.mu.Unlock()
+	return sum
+}
+
+// version returns a string identifying the godoc binary
+// and the configuration that pages are rendered with.
+// The configuration includes every field that may affect the rendered pages,
+// other than the package tree, on which each page depends separately.
+func (cfg *renderConfig) version() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "godoc %s\n", binaryVersion())
+	o := cfg.opts
+	fmt.Fprintf(h, "options %v %v %v %v %v %v %v\n", o.DisableHotlinking, o.DisablePermalinks, o.EnableCommandTOC,
+		o.EnableInteractivePlayground, o.EnableSections, o.EnableLists, o.DocLinkStyle)
+	fmt.Fprintf(h, "platforms %q\n", cfg.platforms)
+	var exampleTags []string
+	if cfg.examples != nil {
+		exampleTags = cfg.examples.tags
+	}
+	fmt.Fprintf(h, "examples %v %q %v %v\n", cfg.examples != nil, exampleTags, cfg.orphanedExamples, cfg.playgroundToken != "")
+	fmt.Fprintf(h, "links %v %q %v %q\n", cfg.deps, cfg.externalURL, cfg.relativeLinks, cfg.basePath)
+	fmt.Fprintf(h, "server %v %v %v\n", cfg.liveReload, cfg.serverSearch, cfg.clientSearch)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// binaryVersion returns a string identifying the godoc binary.
+// It is a variable so that tests can simulate a different binary.
+var binaryVersion = func() string {
+	h := sha256.New()
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(h, "godoc %s\n", bi.Main.Version)
+	}
+	// The module version is insufficient for development builds,
+	// so identify the binary itself.
+	if exe, err := os.Executable(); err == nil {
+		if f, err := os.Open(exe); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dsnet/godoc/internal/render"
+)
+
+func TestConfigVersion(t *testing.T) {
+	base := renderConfig{opts: render.Options{DisableHotlinking: true}}
+	version := base.version()
+
+	// Every option that is not derived for each package must affect the version.
+	opts := reflect.TypeOf(render.Options{})
+	for i := 0; i < opts.NumField(); i++ {
+		f := opts.Field(i)
+		switch f.Name {
+		case "RelatedPackages", "PackageURL":
+			continue // set for each package by renderConfig.newRenderer
+		}
+		cfg := base
+		v := reflect.ValueOf(&cfg.opts).Elem().Field(i)
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(!v.Bool())
+		case reflect.Int:
+			v.SetInt(v.Int() + 1)
+		default:
+			t.Errorf("render.Options.%v has unhandled kind %v", f.Name, v.Kind())
+			continue
+		}
+		if cfg.version() == version {
+			t.Errorf("changing render.Options.%v does not change the version", f.Name)
+		}
+	}
+
+	// Every field of the configuration other than the package tree
+	// must affect the version.
+	changes := map[string]func(*renderConfig){
+		"opts":             nil, // tested above
+		"root":             nil, // hashed for each page
+		"platforms":        func(cfg *renderConfig) { cfg.platforms = []string{"linux/amd64", "windows/amd64"} },
+		"deps":             func(cfg *renderConfig) { cfg.deps = true },
+		"externalURL":      func(cfg *renderConfig) { cfg.externalURL = "https://pkg.go.dev/" },
+		"liveReload":       func(cfg *renderConfig) { cfg.liveReload = true },
+		"relativeLinks":    func(cfg *renderConfig) { cfg.relativeLinks = true },
+		"serverSearch":     func(cfg *renderConfig) { cfg.serverSearch = true },
+		"clientSearch":     func(cfg *renderConfig) { cfg.clientSearch = true },
+		"playgroundToken":  func(cfg *renderConfig) { cfg.playgroundToken = "token" },
+		"orphanedExamples": func(cfg *renderConfig) { cfg.orphanedExamples = true },
+		"examples":         func(cfg *renderConfig) { cfg.examples = new(exampleVerifier) },
+		"basePath":         func(cfg *renderConfig) { cfg.basePath = "/docs" },
+	}
+	fields := reflect.TypeOf(renderConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		change, ok := changes[name]
+		switch {
+		case !ok:
+			t.Errorf("renderConfig.%v is not known to affect the version", name)
+		case change != nil:
+			cfg := base
+			change(&cfg)
+			if cfg.version() == version {
+				t.Errorf("changing renderConfig.%v does not change the version", name)
+			}
+		}
+	}
+
+	// The build tags that examples are run with affect the version.
+	cfg1, cfg2 := base, base
+	cfg1.examples = &exampleVerifier{}
+	cfg2.examples = &exampleVerifier{tags: []string{"purego"}}
+	if cfg1.version() == cfg2.version() {
+		t.Errorf("changing the build tags of examples does not change the version")
+	}
+}
+
+func TestPageRendererReuse(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(data), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("// Package p is a package.\npackage p\n")
+	root := new(packageInfo)
+	root.merge(&packageInfo{name: "p", impPath: "p", dirPath: dir, files: []string{"p.go"}})
+	pkg := root.resolve("p")
+
+	// generate renders the package with the previous output (if any),
+	// and returns the new output and whether the package page was reused.
+	generate := func(cfg *renderConfig, prev mapOutput) (mapOutput, bool) {
+		t.Helper()
+		var pr *pageRenderer
+		if prev != nil {
+			pr = newPageRenderer(cfg, prev)
+		} else {
+			pr = newPageRenderer(cfg, nil) // avoid a non-nil interface
+		}
+		out := make(mapOutput)
+		for _, file := range pr.render(pkg) {
+			out[file.name] = file.data
+		}
+		out[manifestName] = pr.manifest()
+		return out, pr.reused[pkg.impPath]
+	}
+
+	cfg := &renderConfig{root: root, clientSearch: true}
+	out, _ := generate(cfg, nil)
+	if _, ok := out["p/p.go.html"]; !ok {
+		t.Fatalf("source page p/p.go.html is not rendered")
+	}
+	if _, reused := generate(cfg, out); !reused {
+		t.Errorf("unchanged page was not reused")
+	}
+
+	// A changed input file invalidates the page.
+	writeFile("// Package p is a modified package.\npackage p\n")
+	if _, reused := generate(cfg, out); reused {
+		t.Errorf("page was reused after its input file changed")
+	}
+	out, _ = generate(cfg, nil)
+
+	// A changed flag invalidates the page.
+	cfg2 := *cfg
+	cfg2.orphanedExamples = true
+	if _, reused := generate(&cfg2, out); reused {
+		t.Errorf("page was reused after the configuration changed")
+	}
+
+	// A changed binary invalidates the page.
+	defer func(v func() string) { binaryVersion = v }(binaryVersion)
+	binaryVersion = func() string { return "modified" }
+	if _, reused := generate(cfg, out); reused {
+		t.Errorf("page was reused after the binary changed")
+	}
+}
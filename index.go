@@ -0,0 +1,120 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+// moduleIndex is the list of documented packages in a module.
+type moduleIndex struct {
+	Name     string // e.g., "google.golang.org/protobuf@v1.26.0" or "Standard library"
+	Packages []packageSynopsis
+}
+
+// packageSynopsis is the one-line summary of a documented package.
+type packageSynopsis struct {
+	ImpPath  string
+	Synopsis string
+}
+
+// packageIndex returns every documented package in the package tree
+// grouped by module, where the main modules are listed first,
+// followed by all other modules, followed by the standard library.
+func (cfg *renderConfig) packageIndex() []moduleIndex {
+	type moduleKey struct {
+		rank int // 0 for main modules, 1 for other modules, 2 for the standard library
+		name string
+	}
+	modules := make(map[moduleKey][]packageSynopsis)
+	cfg.root.walk(func(pkg *packageInfo) bool {
+		if pkg.dirPath == "" || !cfg.documented(pkg) {
+			return true
+		}
+		key := moduleKey{2, "Standard library"}
+		if m := pkg.module; m != nil {
+			key = moduleKey{1, m.Path}
+			if m.Main {
+				key.rank = 0
+			}
+			if m.Version != "" {
+				key.name += "@" + m.Version
+			}
+		}
+		modules[key] = append(modules[key], packageSynopsis{pkg.impPath, pkg.synopsis()})
+		return true
+	})
+
+	var keys []moduleKey
+	for key := range modules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].rank != keys[j].rank {
+			return keys[i].rank < keys[j].rank
+		}
+		return keys[i].name < keys[j].name
+	})
+	var index []moduleIndex
+	for _, key := range keys {
+		index = append(index, moduleIndex{key.name, modules[key]})
+	}
+	return index
+}
+
+// synopsis returns the first sentence of the package documentation.
+// Only the package clause of each file is parsed.
+func (pkg *packageInfo) synopsis() string {
+	fset := token.NewFileSet()
+	for _, name := range pkg.files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(pkg.dirPath, name), nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err == nil && file.Doc != nil {
+			return doc.Synopsis(file.Doc.Text())
+		}
+	}
+	return ""
+}
+
+// sitemap returns a sitemap (see https://www.sitemaps.org) for the pages
+// of the specified packages, where siteURL is the URL that the root of
+// the generated output is hosted at (e.g., "https://example.com").
+// If siteURL is empty, the locations are relative to the root of the output,
+// which is sufficient for tools that resolve them against the URL that
+// the sitemap is retrieved from, but not for search engines,
+// which require absolute URLs.
+func (cfg *renderConfig) sitemap(siteURL string, pkgs []*packageInfo) []byte {
+	type sitemapURL struct {
+		Loc string `xml:"loc"`
+	}
+	var urlset struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+	for _, pkg := range pkgs {
+		loc := cfg.pageURL("", pkg.impPath)
+		if siteURL != "" {
+			if !strings.HasPrefix(loc, "/") {
+				loc = "/" + loc // relative to the root
+			}
+			loc = strings.TrimSuffix(siteURL, "/") + loc
+		}
+		urlset.URLs = append(urlset.URLs, sitemapURL{loc})
+	}
+	b, err := xml.MarshalIndent(urlset, "", "\t")
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return append(append([]byte(xml.Header), b...), '\n')
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSitemap(t *testing.T) {
+	pkgs := []*packageInfo{{impPath: ""}, {impPath: "archive/tar"}}
+	tests := []struct {
+		cfg     renderConfig
+		siteURL string
+		want    []string
+	}{{
+		want: []string{"/", "/archive/tar"},
+	}, {
+		cfg:  renderConfig{basePath: "/docs"},
+		want: []string{"/docs/", "/docs/archive/tar"},
+	}, {
+		cfg:  renderConfig{relativeLinks: true},
+		want: []string{"index.html", "archive/tar/index.html"},
+	}, {
+		siteURL: "https://example.com/",
+		want:    []string{"https://example.com/", "https://example.com/archive/tar"},
+	}, {
+		cfg:     renderConfig{basePath: "/docs"},
+		siteURL: "https://example.com",
+		want:    []string{"https://example.com/docs/", "https://example.com/docs/archive/tar"},
+	}, {
+		cfg:     renderConfig{relativeLinks: true},
+		siteURL: "https://example.com/docs",
+		want:    []string{"https://example.com/docs/index.html", "https://example.com/docs/archive/tar/index.html"},
+	}}
+	for i, tt := range tests {
+		var urlset struct {
+			URLs []struct {
+				Loc string `xml:"loc"`
+			} `xml:"url"`
+		}
+		if err := xml.Unmarshal(tt.cfg.sitemap(tt.siteURL, pkgs), &urlset); err != nil {
+			t.Errorf("test %d, invalid sitemap: %v", i, err)
+			continue
+		}
+		var got []string
+		for _, u := range urlset.URLs {
+			got = append(got, u.Loc)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("test %d, sitemap locations mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
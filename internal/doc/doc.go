@@ -45,6 +45,12 @@ type Package struct {
 	// the package. Examples are extracted from _test.go files
 	// provided to NewFromFiles.
 	Examples []*Example
+
+	// OrphanedExamples is a sorted list of examples extracted from
+	// _test.go files provided to NewFromFiles that are not associated
+	// with the package or any of its declarations (e.g., because of
+	// a malformed name or a renamed declaration).
+	OrphanedExamples []*Example
 }
 
 // Value is the documentation for a (possibly grouped) var or const declaration.
@@ -156,7 +162,8 @@ func New(pkg *ast.Package, importPath string, mode Mode) *Package {
 // Examples found in _test.go files are associated with the corresponding
 // type, function, method, or the package, based on their name.
 // If the example has a suffix in its name, it is set in the
-// Example.Suffix field. Examples with malformed names are skipped.
+// Example.Suffix field. Examples with malformed names are not associated
+// with anything and are listed in Package.OrphanedExamples instead.
 //
 // Optionally, a single extra argument of type Mode can be provided to
 // control low-level aspects of the documentation extraction behavior.
@@ -575,7 +575,8 @@ func lastComment(b *ast.BlockStmt, c []*ast.CommentGroup) (i int, last *ast.Comm
 // 	- ExampleFoo_bar matches a type named Foo_bar
 // 	  or Foo (with a "bar" suffix).
 //
-// Examples with malformed names are not associated with anything.
+// Examples with malformed names are not associated with anything
+// and are assigned to the OrphanedExamples field of the Package.
 //
 func classifyExamples(p *Package, examples []*Example) {
 	if len(examples) == 0 {
@@ -617,7 +618,8 @@ func classifyExamples(p *Package, examples []*Example) {
 		// then trying all positions that contain a '_' character.
 		//
 		// An association is made on the first successful match.
-		// Examples with malformed names that match nothing are skipped.
+		// Examples with malformed names that match nothing are orphaned.
+		matched := false
 		for i := len(ex.Name); i >= 0; i = strings.LastIndexByte(ex.Name[:i], '_') {
 			prefix, suffix, ok := splitExampleName(ex.Name, i)
 			if !ok {
@@ -629,8 +631,12 @@ func classifyExamples(p *Package, examples []*Example) {
 			}
 			ex.Suffix = suffix
 			*exs = append(*exs, ex)
+			matched = true
 			break
 		}
+		if !matched {
+			p.OrphanedExamples = append(p.OrphanedExamples, ex)
+		}
 	}
 
 	// Sort list of example according to the user-specified suffix name.
@@ -289,6 +289,22 @@ func ExampleConflict_conflict_suffix() {} // ambiguous with either Conflict or C
 			t.Errorf("classification mismatch for %q:\ngot  %q\nwant %q", id, got[id], want[id])
 		}
 	}
+
+	// Every invalid example is orphaned.
+	var gotOrphans []string
+	for _, ex := range p.OrphanedExamples {
+		gotOrphans = append(gotOrphans, ex.Name)
+	}
+	wantOrphans := []string{
+		"Const1", "Embed_Func1",
+		"Func1_", "Func1_BadSuffix", "Func1_Foo_BadSuffix",
+		"Type1_", "Type1_BadSuffix", "Type1_Foo_BadSuffix",
+		"Type1_Func1_", "Type1_Func1_BadSuffix", "Type1_Func1_Foo_BadSuffix",
+		"Var1", "_", "_123", "_BadSuffix", "_世界",
+	}
+	if !reflect.DeepEqual(gotOrphans, wantOrphans) {
+		t.Errorf("orphaned examples mismatch:\ngot  %q\nwant %q", gotOrphans, wantOrphans)
+	}
 }
 
 func exampleNames(exs []*doc.Example) (out []string) {
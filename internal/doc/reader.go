@@ -868,6 +868,11 @@ func IsPredeclared(s string) bool {
 	return predeclaredTypes[s] || predeclaredFuncs[s] || predeclaredConstants[s]
 }
 
+// IsPredeclaredType reports whether s is a predeclared type.
+func IsPredeclaredType(s string) bool {
+	return predeclaredTypes[s]
+}
+
 var predeclaredTypes = map[string]bool{
 	"bool":       true,
 	"byte":       true,
@@ -0,0 +1,150 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+// SourceSpan is a span of highlighted Go source code.
+type SourceSpan struct {
+	Text  string
+	Class string // "comment", "keyword", "string", "number", "type", or empty if not highlighted
+}
+
+// HighlightSource splits the Go source code src into lines,
+// where each line is a sequence of highlighted spans.
+// Tokens that span multiple lines (e.g., block comments and raw strings)
+// are split at the line boundaries.
+// Only predeclared types are highlighted as types.
+// Source code that fails to scan is highlighted on a best-effort basis.
+func HighlightSource(src []byte) [][]SourceSpan {
+	var lines [][]SourceSpan
+	var line []SourceSpan
+	add := func(text, class string) {
+		for {
+			i := strings.IndexByte(text, '\n')
+			if i < 0 {
+				break
+			}
+			if i > 0 {
+				line = append(line, SourceSpan{text[:i], class})
+			}
+			lines = append(lines, line)
+			line, text = nil, text[i+len("\n"):]
+		}
+		if text != "" {
+			line = append(line, SourceSpan{text, class})
+		}
+	}
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	var types typeHighlighter
+	var lastOffset int // last src offset added to the lines
+	for {
+		p, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		class := tokenClass(tok)
+		if types.next(tok, lit) {
+			class = "type"
+		}
+		offset := file.Offset(p)
+		if class == "" || offset < lastOffset {
+			continue // copied as unhighlighted text before the next token
+		}
+		add(string(src[lastOffset:offset]), "")
+		end := tokenEnd(src, offset, tok, lit)
+		add(string(src[offset:end]), class)
+		lastOffset = end
+	}
+	add(string(src[lastOffset:]), "")
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// tokenClass returns the highlighting class for tok.
+func tokenClass(tok token.Token) string {
+	switch {
+	case tok == token.COMMENT:
+		return "comment"
+	case tok.IsKeyword():
+		return "keyword"
+	case tok == token.STRING || tok == token.CHAR:
+		return "string"
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return "number"
+	}
+	return ""
+}
+
+// typeHighlighter reports which identifiers in a sequence of tokens
+// refer to types, which are the predeclared types, the types declared
+// in the package being rendered, and the types qualified by the name of
+// a related package (e.g., "io.Reader").
+// Lacking type information, an identifier that merely has the same name
+// as a type (e.g., a struct field) is also reported as a type.
+type typeHighlighter struct {
+	pids *packageIDs // may be nil to only report predeclared types
+
+	prevTok, prevTok2 token.Token // last two tokens, excluding comments
+	prevLit, prevLit2 string      // literals of the last two tokens
+}
+
+// next reports whether the next token in the sequence is a type.
+func (h *typeHighlighter) next(tok token.Token, lit string) (isType bool) {
+	if tok == token.COMMENT {
+		return false
+	}
+	if tok == token.IDENT {
+		switch {
+		case h.prevTok != token.PERIOD:
+			isType = doc.IsPredeclaredType(lit) || h.pids != nil && h.pids.typeIDs[h.pids.name][lit]
+		case h.prevTok2 == token.IDENT && h.pids != nil && h.pids.impPaths[h.prevLit2] != "":
+			isType = h.pids.typeIDs[h.prevLit2][lit] // E.g., "io.Reader"
+		}
+	}
+	h.prevTok, h.prevTok2 = tok, h.prevTok
+	h.prevLit, h.prevLit2 = lit, h.prevLit
+	return isType
+}
+
+// tokenEnd returns the offset in src just past the token at offset.
+// The literal reported by the scanner is not always verbatim
+// since carriage returns are stripped from comments and raw strings.
+func tokenEnd(src []byte, offset int, tok token.Token, lit string) int {
+	var i int
+	switch {
+	case tok == token.COMMENT && bytes.HasPrefix(src[offset:], []byte("//")):
+		i = bytes.IndexByte(src[offset:], '\n')
+	case tok == token.COMMENT:
+		if i = bytes.Index(src[offset+len("/*"):], []byte("*/")); i >= 0 {
+			i += len("/*") + len("*/")
+		}
+	case tok == token.STRING && src[offset] == '`':
+		if i = bytes.IndexByte(src[offset+len("`"):], '`'); i >= 0 {
+			i += len("`") + len("`")
+		}
+	case tok.IsKeyword():
+		i = len(tok.String())
+	default:
+		i = len(lit)
+	}
+	if i < 0 || offset+i > len(src) {
+		return len(src) // unterminated token
+	}
+	return offset + i
+}
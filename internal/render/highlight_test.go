@@ -0,0 +1,60 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHighlightSource(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [][]SourceSpan
+	}{{
+		in:   "",
+		want: nil,
+	}, {
+		in: "package p\n\nvar x float64 = 1.5 // comment\n",
+		want: [][]SourceSpan{
+			{{"package", "keyword"}, {" p", ""}},
+			nil,
+			{{"var", "keyword"}, {" x ", ""}, {"float64", "type"}, {" = ", ""}, {"1.5", "number"}, {" ", ""}, {"// comment", "comment"}},
+		},
+	}, {
+		in: "const s = `a\r\nb` + \"c\" + 'd'",
+		want: [][]SourceSpan{
+			{{"const", "keyword"}, {" s = ", ""}, {"`a\r", "string"}},
+			{{"b`", "string"}, {" + ", ""}, {`"c"`, "string"}, {" + ", ""}, {"'d'", "string"}},
+		},
+	}, {
+		in: "/* a\n\n b */ func f() {\n\treturn\n}",
+		want: [][]SourceSpan{
+			{{"/* a", "comment"}},
+			nil,
+			{{" b */", "comment"}, {" ", ""}, {"func", "keyword"}, {" f() {", ""}},
+			{{"\t", ""}, {"return", "keyword"}},
+			{{"}", ""}},
+		},
+	}, {
+		in: "var t T; n := int(x.string)",
+		want: [][]SourceSpan{
+			{{"var", "keyword"}, {" t T; n := ", ""}, {"int", "type"}, {"(x.string)", ""}},
+		},
+	}, {
+		in: "x := `unterminated\n",
+		want: [][]SourceSpan{
+			{{"x := ", ""}, {"`unterminated", "string"}},
+		},
+	}}
+
+	for _, tt := range tests {
+		got := HighlightSource([]byte(tt.in))
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("HighlightSource(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
@@ -81,6 +81,12 @@ type packageIDs struct {
 	// E.g., pkgIDs["json"]["Encoder.Encode"] == true
 	pkgIDs map[string]map[string]bool // map[name]map[topLevelID]bool
 
+	// typeIDs is the set of all top-level type names in this package and
+	// any related package.
+	//
+	// E.g., typeIDs["json"]["Encoder"] == true
+	typeIDs map[string]map[string]bool // map[name]map[typeName]bool
+
 	// topLevelDecls is the set of all AST declarations for the this package.
 	topLevelDecls map[interface{}]bool // map[T]bool where T is *ast.FuncDecl | *ast.GenDecl | *ast.TypeSpec | *ast.ValueSpec
 }
@@ -92,6 +98,7 @@ func newPackageIDs(pkg *doc.Package, related ...*doc.Package) *packageIDs {
 		name:          pkg.Name,
 		impPaths:      make(map[string]string),
 		pkgIDs:        make(map[string]map[string]bool),
+		typeIDs:       make(map[string]map[string]bool),
 		topLevelDecls: make(map[interface{}]bool),
 	}
 
@@ -102,9 +109,13 @@ func newPackageIDs(pkg *doc.Package, related ...*doc.Package) *packageIDs {
 		}
 		pids.impPaths[pkg.Name] = pkg.ImportPath
 		pids.pkgIDs[pkg.Name] = make(map[string]bool)
+		pids.typeIDs[pkg.Name] = make(map[string]bool)
 		forEachPackageDecl(pkg, func(decl ast.Decl) {
 			for _, idk := range generateAnchorPoints(decl) {
 				pids.pkgIDs[pkg.Name][idk.ID.String()] = true // E.g., ["io"]["Reader.Read"]
+				if idk.Kind == "type" {
+					pids.typeIDs[pkg.Name][idk.ID.String()] = true // E.g., ["io"]["Reader"]
+				}
 			}
 		})
 	}
@@ -339,6 +350,34 @@ func (r identifierResolver) lookup(id string) (pkgPath, name string, ok bool) {
 	return "", "", false // not found
 }
 
+// lookupRef looks up a doc link reference, which is like the identifiers
+// accepted by lookup, but may also be qualified by a full package path.
+// E.g., "encoding/json", "encoding/json.Decoder", "encoding/json.Decoder.Decode"
+func (r identifierResolver) lookupRef(ref string) (pkgPath, name string, ok bool) {
+	i := strings.LastIndexByte(ref, '/')
+	if i < 0 {
+		return r.lookup(ref)
+	}
+	pkgPath, id := ref, ""
+	if j := strings.IndexByte(ref[i:], '.'); j >= 0 {
+		pkgPath, id = ref[:i+j], ref[i+j+len("."):]
+	}
+	for pkgName, path := range r.impPaths {
+		if path == pkgPath {
+			if id == "" {
+				return pkgPath, "", true
+			}
+			if r.pkgIDs[pkgName][id] {
+				if pkgName == r.name {
+					pkgPath = ""
+				}
+				return pkgPath, id, true
+			}
+		}
+	}
+	return "", "", false // not found
+}
+
 func nodeName(n ast.Node) (string, *ast.Ident) {
 	switch n := n.(type) {
 	case *ast.Ident:
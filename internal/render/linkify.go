@@ -52,27 +52,45 @@ const (
 
 	// Regexp for RFCs.
 	rfcRx = `RFC\s+(\d{3,5})(,?\s+[Ss]ection\s+(\d+(\.\d+)*))?`
+
+	// Regexp for doc link references
+	// (e.g. "io.Reader", "*bytes.Buffer", or "encoding/json.Decoder").
+	docRefRx = `\*?[\pL_]([\pL_0-9./\-]*[\pL_0-9])?`
 )
 
 var (
 	matchRx     = regexp.MustCompile(urlRx + `|` + rfcRx + `|` + qualIdentRx)
 	badAnchorRx = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+	// docLinkRxs are the regexps for delimited doc links for each style.
+	// The first submatch is the reference within the delimiters.
+	docLinkRxs = map[DocLinkStyle]*regexp.Regexp{
+		BracketDocLinks:   regexp.MustCompile(`\[(` + docRefRx + `)\]`),
+		BacktickDocLinks:  regexp.MustCompile("`(" + docRefRx + ")`"),
+		BackquoteDocLinks: regexp.MustCompile("`(" + docRefRx + ")'"),
+	}
 )
 
 type docData struct {
 	Elements          []docElement
 	DisablePermalinks bool
-	EnableCommandTOC  bool
+	EnableTOC         bool
 }
 
 type docElement struct {
 	IsHeading   bool
 	IsPreformat bool
+	IsList      bool
 	// for paragraph and preformat
 	Body safehtml.HTML
 	// for heading
 	Title string
+	Level int
 	ID    safehtml.Identifier
+	// for list
+	IsOrdered bool
+	Start     int
+	Items     []safehtml.HTML
 }
 
 func (r *Renderer) declHTML(doc string, decl ast.Decl, extractLinks bool) (out struct{ Doc, Decl safehtml.HTML }) {
@@ -80,8 +98,10 @@ func (r *Renderer) declHTML(doc string, decl ast.Decl, extractLinks bool) (out s
 	idr := &identifierResolver{r.pids, dids, r.packageURL}
 	if doc != "" {
 		var els []docElement
+		var hdrIDs []string // IDs of the current heading and its parents
+		var hasHeadings bool
 		inLinks := false
-		for _, blk := range docToBlocks(doc) {
+		for _, blk := range docToBlocks(doc, syntaxOptions{sections: r.enableSections, lists: r.enableLists}) {
 			var el docElement
 			switch blk := blk.(type) {
 			case *paragraph:
@@ -99,6 +119,20 @@ func (r *Renderer) declHTML(doc string, decl ast.Decl, extractLinks bool) (out s
 					el.Body = r.linesToHTML(blk.lines, nil)
 					els = append(els, el)
 				}
+			case *list:
+				if inLinks {
+					for _, item := range blk.items {
+						r.links = append(r.links, parseLinks([]string{"- " + strings.Join(item, " ")})...)
+					}
+				} else {
+					el.IsList = true
+					el.IsOrdered = blk.ordered
+					el.Start = blk.start
+					for _, item := range blk.items {
+						el.Items = append(el.Items, r.linesToHTML(item, idr))
+					}
+					els = append(els, el)
+				}
 			case *heading:
 				if extractLinks && blk.title == "Links" {
 					inLinks = true
@@ -106,14 +140,30 @@ func (r *Renderer) declHTML(doc string, decl ast.Decl, extractLinks bool) (out s
 					inLinks = false
 					el.IsHeading = true
 					el.Title = blk.title
+					el.Level = blk.level
 					id := badAnchorRx.ReplaceAllString(blk.title, "_")
+					if r.enableSections {
+						// Nest the ID within the IDs of all parent headings.
+						// Since badAnchorRx never preserves '-', the result
+						// is unambiguous.
+						if len(hdrIDs) >= blk.level {
+							hdrIDs = hdrIDs[:blk.level-1]
+						}
+						hdrIDs = append(hdrIDs, id)
+						id = strings.Join(hdrIDs, "-")
+					}
 					el.ID = safehtml.IdentifierFromConstantPrefix("hdr", id)
 					els = append(els, el)
+					hasHeadings = true
 				}
 			}
 		}
+		enableTOC := r.enableCommandTOC && len(els) > 0
+		if r.enableSections && decl == nil && hasHeadings {
+			enableTOC = true
+		}
 		out.Doc = ExecuteToHTML(r.docTmpl, docData{Elements: els,
-			DisablePermalinks: r.disablePermalinks, EnableCommandTOC: r.enableCommandTOC})
+			DisablePermalinks: r.disablePermalinks, EnableTOC: enableTOC})
 	}
 	if decl != nil {
 		out.Decl = r.formatDeclHTML(decl, idr)
@@ -189,15 +239,21 @@ func (r *Renderer) codeHTML(ex *doc.Example) safehtml.HTML {
 	if err != nil {
 		return template.MustParseAndExecuteToHTML(`<pre class="Documentation-exampleCode">Error rendering example code.</pre>`)
 	}
-	return codeHTML(codeStr, r.exampleTmpl)
+	idr := &identifierResolver{r.pids, newDeclIDs(nil), r.packageURL}
+	return codeHTML(codeStr, r.exampleTmpl, idr)
 }
 
 type codeElement struct {
-	Text    string
-	Comment bool
+	Text  string
+	Class string // highlighting class (see SourceSpan); optional
+	Href  string // URL that the text links to; optional
 }
 
-func codeHTML(src string, codeTmpl *template.Template) safehtml.HTML {
+// codeHTML formats the example code src as HTML using codeTmpl.
+// If idr is non-nil, package-qualified identifiers are linked
+// to the declarations that they refer to, and the types of the package
+// and related packages are highlighted in addition to predeclared types.
+func codeHTML(src string, codeTmpl *template.Template, idr *identifierResolver) safehtml.HTML {
 	var els []codeElement
 	// If code is an *ast.BlockStmt, then trim the braces.
 	var indent string
@@ -209,7 +265,14 @@ func codeHTML(src string, codeTmpl *template.Template) safehtml.HTML {
 		}
 	}
 
-	// Scan through the source code, adding comment spans for comments,
+	links := codeLinks(src, idr)
+	var types typeHighlighter
+	if idr != nil {
+		types.pids = idr.packageIDs
+	}
+
+	// Scan through the source code, adding highlighting spans for tokens,
+	// links for package-qualified identifiers,
 	// and stripping the trailing example output.
 	var lastOffset int        // last src offset copied to output buffer
 	var outputOffset int = -1 // index in els of last output comment
@@ -222,10 +285,14 @@ scan:
 	for {
 		p, tok, lit := s.Scan()
 		offset := file.Offset(p) // current offset into source file
+		if offset < lastOffset {
+			offset = lastOffset // implicit semicolon within a prior comment
+		}
 		prev := src[lastOffset:offset]
 		prev = strings.Replace(prev, indent, "\n", -1)
-		els = append(els, codeElement{prev, false})
+		els = append(els, codeElement{Text: prev})
 		lastOffset = offset
+		isType := types.next(tok, lit)
 		switch tok {
 		case token.EOF:
 			break scan
@@ -234,12 +301,26 @@ scan:
 				outputOffset = len(els)
 			}
 			lit = strings.Replace(lit, indent, "\n", -1)
-			els = append(els, codeElement{lit, true})
+			els = append(els, codeElement{Text: lit, Class: "comment"})
 			lastOffset += len(lit)
 		case token.STRING:
 			// Avoid replacing indents in multi-line string literals.
-			els = append(els, codeElement{lit, false})
+			els = append(els, codeElement{Text: lit, Class: "string"})
 			lastOffset += len(lit)
+		case token.IDENT:
+			if href := links[offset]; href != "" || isType {
+				el := codeElement{Text: lit, Href: href}
+				if isType {
+					el.Class = "type"
+				}
+				els = append(els, el)
+				lastOffset += len(lit)
+			}
+		default:
+			if class := tokenClass(tok); class != "" {
+				els = append(els, codeElement{Text: lit, Class: class})
+				lastOffset += len(lit)
+			}
 		}
 	}
 
@@ -253,11 +334,60 @@ scan:
 	return ExecuteToHTML(codeTmpl, els)
 }
 
+// codeLinks returns the URLs for package-qualified identifiers in src
+// (e.g., "json.Marshal"), keyed by the source offset of each identifier.
+// Both the package name and the qualified identifier are linked,
+// similar to package-qualified identifiers in declarations.
+func codeLinks(src string, idr *identifierResolver) map[int]string {
+	if idr == nil {
+		return nil
+	}
+	type scannedToken struct {
+		offset int
+		tok    token.Token
+		lit    string
+	}
+	links := make(map[int]string)
+	var toks [4]scannedToken // last four tokens, where the latest is last
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, []byte(src), nil, 0)
+	for {
+		p, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		copy(toks[:], toks[1:])
+		toks[3] = scannedToken{file.Offset(p), tok, lit}
+
+		// Match an identifier selected from a package name (e.g., "json.Marshal"),
+		// but not from some other expression (e.g., "x.json.Marshal").
+		prev, pkg, dot, sel := toks[0], toks[1], toks[2], toks[3]
+		if prev.tok == token.PERIOD || pkg.tok != token.IDENT || dot.tok != token.PERIOD || sel.tok != token.IDENT {
+			continue
+		}
+		if dot.offset != pkg.offset+len(pkg.lit) || sel.offset != dot.offset+len(".") {
+			continue
+		}
+		pkgPath, ok := idr.impPaths[pkg.lit]
+		if !ok {
+			continue
+		}
+		if path, name, ok := idr.lookup(pkg.lit + "." + sel.lit); ok && name == sel.lit {
+			links[pkg.offset] = idr.toURL(pkgPath, "")
+			links[sel.offset] = idr.toURL(path, name)
+		}
+	}
+	return links
+}
+
 // formatLineHTML formats the line as HTML-annotated text.
 // URLs and Go identifiers are linked to corresponding declarations.
 func (r *Renderer) formatLineHTML(line string, idr *identifierResolver) safehtml.HTML {
 	var htmls []safehtml.HTML
 	var lastChar, nextChar byte
+	var prevChar byte // last character of the previous iteration
 	var numQuotes int
 
 	addLink := func(href, text string) {
@@ -265,11 +395,30 @@ func (r *Renderer) formatLineHTML(line string, idr *identifierResolver) safehtml
 	}
 
 	line = convertQuotes(line)
+	docLinkRx := docLinkRxs[r.docLinkStyle]
 	for len(line) > 0 {
 		m0, m1 := len(line), len(line)
 		if m := matchRx.FindStringIndex(line); m != nil {
 			m0, m1 = m[0], m[1]
 		}
+
+		// Explicitly delimited doc links take precedence over
+		// any other match starting at the same position or later.
+		// Unresolvable doc links are formatted as ordinary text.
+		if m := findDocLink(docLinkRx, line); m != nil && m[0] <= m0 && idr != nil && isDocLinkBounded(line, m, prevChar) {
+			if html, ok := r.docLinkHTML(line[m[2]:m[3]], idr); ok {
+				if m[0] > 0 {
+					nonWord := line[:m[0]]
+					htmls = append(htmls, safehtml.HTMLEscaped(nonWord))
+					numQuotes += countQuotes(nonWord)
+				}
+				htmls = append(htmls, html)
+				lastChar, prevChar = line[m[1]-1], line[m[1]-1]
+				line = line[m[1]:]
+				continue
+			}
+		}
+
 		if m0 > 0 {
 			nonWord := line[:m0]
 			htmls = append(htmls, safehtml.HTMLEscaped(nonWord))
@@ -338,11 +487,113 @@ func (r *Renderer) formatLineHTML(line string, idr *identifierResolver) safehtml
 			}
 			numQuotes += countQuotes(word)
 		}
+		if m1 > 0 {
+			prevChar = line[m1-1]
+		}
 		line = line[m1:]
 	}
 	return safehtml.HTMLConcat(htmls...)
 }
 
+// docLinkHTML formats a doc link reference (e.g., "io.Reader") as HTML.
+// It reports false if the reference cannot be resolved.
+func (r *Renderer) docLinkHTML(ref string, idr *identifierResolver) (safehtml.HTML, bool) {
+	path, name, ok := idr.lookupRef(strings.TrimPrefix(ref, "*"))
+	if !ok {
+		return safehtml.HTML{}, false
+	}
+	html := ExecuteToHTML(LinkTemplate, Link{Href: idr.toURL(path, name), Text: ref})
+	switch r.docLinkStyle {
+	case BacktickDocLinks, BackquoteDocLinks:
+		html = safehtml.HTMLConcat(
+			template.MustParseAndExecuteToHTML(`<code>`),
+			html,
+			template.MustParseAndExecuteToHTML(`</code>`))
+	}
+	return html, true
+}
+
+// findDocLink returns the submatch indexes of the first doc link in line.
+// It returns nil if there is no match or if rx is nil.
+func findDocLink(rx *regexp.Regexp, line string) []int {
+	if rx == nil {
+		return nil
+	}
+	return rx.FindStringSubmatchIndex(line)
+}
+
+// isDocLinkBounded reports whether the doc link match m within line is
+// separated from any surrounding text, where prevChar is the character
+// preceding line. This avoids matching text such as "x[i]" or "[text](url)".
+func isDocLinkBounded(line string, m []int, prevChar byte) bool {
+	before, after := prevChar, byte(0)
+	if m[0] > 0 {
+		before = line[m[0]-1]
+	}
+	if m[1] < len(line) {
+		after = line[m[1]]
+	}
+	return !isWordChar(before) && !isWordChar(after) && after != '('
+}
+
+// DocLink is a delimited reference to a Go identifier or package
+// within documentation.
+type DocLink struct {
+	Line     int    // 0-indexed line number within the documentation
+	Ref      string // reference without delimiters (e.g., "io.Reader")
+	Resolved bool   // whether the reference refers to a known declaration
+}
+
+// DocLinks returns every delimited doc link in doc according to
+// the DocLinkStyle option, and reports whether each one can be resolved.
+// Doc links in preformatted text are ignored, since they are never linked.
+//
+// Unlike DocHTML, lines in doc are not trimmed, so that each DocLink.Line
+// corresponds with a line of the input.
+func (r *Renderer) DocLinks(doc string) []DocLink {
+	rx := docLinkRxs[r.docLinkStyle]
+	if rx == nil {
+		return nil
+	}
+	idr := &identifierResolver{r.pids, newDeclIDs(nil), r.packageURL}
+
+	var links []DocLink
+	var inCode, inList bool
+	for i, line := range unindent(strings.Split(doc, "\n")) {
+		// Indented lines (and any blank lines that follow them) are
+		// preformatted text, unless the first line begins a list.
+		switch {
+		case indentLength(line) > 0:
+			if !inCode {
+				n, _ := listMarker(trimIndent(line))
+				inList = r.enableLists && n > 0
+			}
+			inCode = true
+		case line != "":
+			inCode = false
+		}
+		if inCode && !inList {
+			continue
+		}
+
+		line = convertQuotes(line)
+		for _, m := range rx.FindAllStringSubmatchIndex(line, -1) {
+			if !isDocLinkBounded(line, m, 0) {
+				continue
+			}
+			ref := line[m[2]:m[3]]
+			_, _, ok := idr.lookupRef(strings.TrimPrefix(ref, "*"))
+			links = append(links, DocLink{Line: i, Ref: ref, Resolved: ok})
+		}
+	}
+	return links
+}
+
+// isWordChar reports whether c is an ASCII letter, digit, or underscore.
+func isWordChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
 func ExecuteToHTML(tmpl *template.Template, data interface{}) safehtml.HTML {
 	h, err := tmpl.ExecuteToHTML(data)
 	if err != nil {
@@ -407,6 +658,7 @@ func (r *Renderer) formatDeclHTML(decl ast.Decl, idr *identifierResolver) safeht
 	// for comments, and HTML links and anchors for relevant identifiers.
 	var idIdx int      // current index in anchorPoints and anchorLinks
 	var lastOffset int // last src offset copied to output buffer
+	types := typeHighlighter{pids: idr.packageIDs}
 	var s scanner.Scanner
 	s.Init(file, src, nil, scanner.ScanComments)
 scan:
@@ -415,6 +667,9 @@ scan:
 		line := file.Line(p) - 1 // current 0-indexed line number
 		offset := file.Offset(p) // current offset into source file
 		tokType := codeType      // current token type (assume source code)
+		if offset < lastOffset {
+			offset = lastOffset // implicit semicolon within a prior comment
+		}
 
 		// Add traversed bytes from src to the appropriate line.
 		prevLines := strings.SplitAfter(string(src[lastOffset:offset]), "\n")
@@ -427,6 +682,7 @@ scan:
 		}
 
 		lastOffset = offset
+		isType := types.next(tok, lit)
 		switch tok {
 		case token.EOF:
 			break scan
@@ -441,11 +697,24 @@ scan:
 			if idIdx < len(anchorPoints) && anchorPoints[idIdx].ID.String() != "" {
 				anchorLines[line] = append(anchorLines[line], anchorPoints[idIdx])
 			}
+			var class string
+			if isType {
+				class = "type"
+			}
 			if idIdx < len(anchorLinks) && anchorLinks[idIdx] != "" {
-				htmlLines[line] = append(htmlLines[line], ExecuteToHTML(LinkTemplate, Link{Href: anchorLinks[idIdx], Text: lit}))
+				htmlLines[line] = append(htmlLines[line], ExecuteToHTML(LinkTemplate, Link{Href: anchorLinks[idIdx], Text: lit, Class: class}))
+				lastOffset += len(lit)
+			} else if isType {
+				htmlLines[line] = append(htmlLines[line], ExecuteToHTML(spanTemplate, SourceSpan{Text: lit, Class: class}))
 				lastOffset += len(lit)
 			}
 			idIdx++
+		default:
+			if class := tokenClass(tok); class != "" {
+				end := tokenEnd(src, offset, tok, lit)
+				htmlLines[line] = append(htmlLines[line], ExecuteToHTML(spanTemplate, SourceSpan{Text: string(src[offset:end]), Class: class}))
+				lastOffset = end
+			}
 		}
 		for i := strings.Count(strings.TrimSuffix(lit, "\n"), "\n"); i >= 0; i-- {
 			lineTypes[line+i] |= tokType
@@ -490,6 +759,8 @@ scan:
 	return safehtml.HTMLConcat(htmls...)
 }
 
+var spanTemplate = template.Must(template.New("span").Parse(`<span class="{{.Class}}">{{.Text}}</span>`))
+
 var anchorTemplate = template.Must(template.New("anchor").Parse(`<span id="{{.ID}}" data-kind="{{.Kind}}">`))
 
 // rewriteDecl rewrites n by removing strings longer than maxStringSize and
@@ -180,6 +180,134 @@ TLSUnique contains the tls-unique channel binding value (see RFC
 	}
 }
 
+func TestDocHTMLSections(t *testing.T) {
+	doc := `Package comment.
+
+# Overview
+
+## Details
+
+### More details
+
+## Caveats
+
+# Usage
+
+See above.`
+	want := `<div role="navigation" aria-label="Table of Contents">
+		<ul class="Documentation-toc"><li class="Documentation-tocItem"><a href="#hdr-Overview">Overview</a>
+					</li><li class="Documentation-tocItem Documentation-tocItem--level2"><a href="#hdr-Overview-Details">Details</a>
+					</li><li class="Documentation-tocItem Documentation-tocItem--level3"><a href="#hdr-Overview-Details-More_details">More details</a>
+					</li><li class="Documentation-tocItem Documentation-tocItem--level2"><a href="#hdr-Overview-Caveats">Caveats</a>
+					</li><li class="Documentation-tocItem"><a href="#hdr-Usage">Usage</a>
+					</li></ul>
+	</div><p>Package comment.
+</p><h4 id="hdr-Overview">Overview</h4>
+  <h5 id="hdr-Overview-Details">Details</h5>
+  <h6 id="hdr-Overview-Details-More_details">More details</h6>
+  <h5 id="hdr-Overview-Caveats">Caveats</h5>
+  <h4 id="hdr-Usage">Usage</h4>
+  <p>See above.
+</p>`
+	r := New(context.Background(), nil, pkgTime, &Options{DisablePermalinks: true, EnableSections: true})
+	got := r.DocHTML(doc).String()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.DocHTML() mismatch (-want +got)\n%s", diff)
+	}
+}
+
+func TestDocHTMLLists(t *testing.T) {
+	doc := `Units:
+	- Nanosecond
+	- a Duration
+	  in seconds
+Steps:
+	2. first
+	3. second`
+	want := `<p>Units:
+</p><ul><li><a href="#Nanosecond">Nanosecond</a>
+</li><li>a <a href="#Duration">Duration</a>
+in seconds
+</li></ul><p>Steps:
+</p><ol start="2"><li>first
+</li><li>second
+</li></ol>`
+	r := New(context.Background(), nil, pkgTime, &Options{EnableLists: true})
+	got := r.DocHTML(doc).String()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.DocHTML() mismatch (-want +got)\n%s", diff)
+	}
+}
+
+func TestDocHTMLDocLinks(t *testing.T) {
+	for _, test := range []struct {
+		style DocLinkStyle
+		doc   string
+		want  string
+	}{{
+		style: NoDocLinks,
+		doc:   `See [Reader.Read] and [io.Reader].`,
+		want:  `See [Reader.Read] and [io.Reader].`,
+	}, {
+		style: BracketDocLinks,
+		doc:   `See [Reader.Read], [*Writer], [io], and [io.Reader].`,
+		want:  `See <a href="#Reader.Read">Reader.Read</a>, <a href="#Writer">*Writer</a>, <a href="/io">io</a>, and <a href="/io#Reader">io.Reader</a>.`,
+	}, {
+		style: BracketDocLinks,
+		doc:   `Use [archive/tar.NewReader] or [time.Duration.String] but not Reader or [1].`,
+		want:  `Use <a href="#NewReader">archive/tar.NewReader</a> or <a href="/time#Duration.String">time.Duration.String</a> but not Reader or [1].`,
+	}, {
+		style: BracketDocLinks,
+		doc:   `Unresolved [NoExist], [encoding/json.Decoder], x[Reader], and [Reader](url).`,
+		want:  `Unresolved [NoExist], [encoding/json.Decoder], x[Reader], and [Reader](url).`,
+	}, {
+		style: BacktickDocLinks,
+		doc:   "See `Reader.Read`, `io.Reader`, `NoExist`, [io.Reader], and ``quoted''.",
+		want:  `See <code><a href="#Reader.Read">Reader.Read</a></code>, <code><a href="/io#Reader">io.Reader</a></code>, ` + "`NoExist`" + `, [io.Reader], and “quoted”.`,
+	}, {
+		style: BackquoteDocLinks,
+		doc:   "See `Reader.Read', `archive/tar.Writer', `io.Reader`, and `NoExist'.",
+		want:  `See <code><a href="#Reader.Read">Reader.Read</a></code>, <code><a href="#Writer">archive/tar.Writer</a></code>, ` + "`io.Reader`" + `, and ` + "`NoExist&#39;.",
+	}} {
+		r := New(context.Background(), nil, pkgTar, &Options{
+			RelatedPackages:   []*doc.Package{pkgIO, pkgOS, pkgTime},
+			DisableHotlinking: true,
+			DocLinkStyle:      test.style,
+		})
+		got := r.DocHTML(test.doc).String()
+		want := "<p>" + test.want + "\n</p>"
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("r.DocHTML(%q) mismatch (-want +got)\n%s", test.doc, diff)
+		}
+	}
+}
+
+func TestDocLinks(t *testing.T) {
+	text := `See [Reader.Read] and [NoExist].
+
+Code is ignored:
+	[NoExist]
+
+Lists are not:
+	- [io.Reader] or [io.NoExist]
+	  and x[NoExist]`
+	want := []DocLink{
+		{Line: 0, Ref: "Reader.Read", Resolved: true},
+		{Line: 0, Ref: "NoExist"},
+		{Line: 6, Ref: "io.Reader", Resolved: true},
+		{Line: 6, Ref: "io.NoExist"},
+	}
+	r := New(context.Background(), nil, pkgTar, &Options{
+		RelatedPackages: []*doc.Package{pkgIO},
+		EnableLists:     true,
+		DocLinkStyle:    BracketDocLinks,
+	})
+	got := r.DocLinks(text)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.DocLinks() mismatch (-want +got)\n%s", diff)
+	}
+}
+
 func TestDeclHTML(t *testing.T) {
 	for _, test := range []struct {
 		name   string
@@ -189,44 +317,44 @@ func TestDeclHTML(t *testing.T) {
 		{
 			name:   "const",
 			symbol: "Nanosecond",
-			want: `const (
-<span id="Nanosecond" data-kind="constant">	Nanosecond  <a href="#Duration">Duration</a> = 1
-</span><span id="Microsecond" data-kind="constant">	Microsecond          = 1000 * <a href="#Nanosecond">Nanosecond</a>
-</span><span id="Millisecond" data-kind="constant">	Millisecond          = 1000 * <a href="#Microsecond">Microsecond</a> <span class="comment">// comment</span>
-</span><span id="Second" data-kind="constant">	Second               = 1000 * <a href="#Millisecond">Millisecond</a> <span class="comment">/* multi
+			want: `<span class="keyword">const</span> (
+<span id="Nanosecond" data-kind="constant">	Nanosecond  <a class="type" href="#Duration">Duration</a> = <span class="number">1</span>
+</span><span id="Microsecond" data-kind="constant">	Microsecond          = <span class="number">1000</span> * <a href="#Nanosecond">Nanosecond</a>
+</span><span id="Millisecond" data-kind="constant">	Millisecond          = <span class="number">1000</span> * <a href="#Microsecond">Microsecond</a> <span class="comment">// comment</span>
+</span><span id="Second" data-kind="constant">	Second               = <span class="number">1000</span> * <a href="#Millisecond">Millisecond</a> <span class="comment">/* multi
 	line
 	comment */</span></span>
-<span id="Minute" data-kind="constant">	Minute = 60 * <a href="#Second">Second</a>
-</span><span id="Hour" data-kind="constant">	Hour   = 60 * <a href="#Minute">Minute</a>
+<span id="Minute" data-kind="constant">	Minute = <span class="number">60</span> * <a href="#Second">Second</a>
+</span><span id="Hour" data-kind="constant">	Hour   = <span class="number">60</span> * <a href="#Minute">Minute</a>
 </span>)`,
 		},
 		{
 			name:   "var",
 			symbol: "UTC",
-			want:   `<span id="UTC" data-kind="variable">var UTC *<a href="#Location">Location</a> = &amp;utcLoc</span>`,
+			want:   `<span id="UTC" data-kind="variable"><span class="keyword">var</span> UTC *<a class="type" href="#Location">Location</a> = &amp;utcLoc</span>`,
 		},
 		{
 			name:   "type",
 			symbol: "Ticker",
-			want: `type Ticker struct {
-<span id="Ticker.C" data-kind="field">	C &lt;-chan <a href="#Time">Time</a> <span class="comment">// The channel on which the ticks are delivered.</span>
+			want: `<span class="keyword">type</span> <span class="type">Ticker</span> <span class="keyword">struct</span> {
+<span id="Ticker.C" data-kind="field">	C &lt;-<span class="keyword">chan</span> <a class="type" href="#Time">Time</a> <span class="comment">// The channel on which the ticks are delivered.</span>
 </span>	<span class="comment">// contains filtered or unexported fields</span>
 }`,
 		},
 		{
 			name:   "func",
 			symbol: "Sleep",
-			want:   `func Sleep(d <a href="#Duration">Duration</a>)`,
+			want:   `<span class="keyword">func</span> Sleep(d <a class="type" href="#Duration">Duration</a>)`,
 		},
 		{
 			name:   "method",
 			symbol: "After",
-			want:   `func After(d <a href="#Duration">Duration</a>) &lt;-chan <a href="#Time">Time</a>`,
+			want:   `<span class="keyword">func</span> After(d <a class="type" href="#Duration">Duration</a>) &lt;-<span class="keyword">chan</span> <a class="type" href="#Time">Time</a>`,
 		},
 		{
 			name:   "interface",
 			symbol: "Iface",
-			want: `type Iface interface {
+			want: `<span class="keyword">type</span> <span class="type">Iface</span> <span class="keyword">interface</span> {
 <span id="Iface.M" data-kind="method">	<span class="comment">// Method comment.</span>
 </span>	M()
 	<span class="comment">// contains filtered or unexported methods</span>
@@ -235,20 +363,20 @@ func TestDeclHTML(t *testing.T) {
 		{
 			name:   "long literal",
 			symbol: "TooLongLiteral",
-			want: `type TooLongLiteral struct {
+			want: `<span class="keyword">type</span> <span class="type">TooLongLiteral</span> <span class="keyword">struct</span> {
 <span id="TooLongLiteral.Name" data-kind="field">	<span class="comment">// The name.</span>
-</span>	Name <a href="/builtin#string">string</a>
+</span>	Name <a class="type" href="/builtin#string">string</a>
 
 <span id="TooLongLiteral.Labels" data-kind="field">	<span class="comment">// The labels.</span>
-</span>	Labels <a href="/builtin#int">int</a> ` + "``" + ` <span class="comment">/* 137-byte string literal not displayed */</span>
+</span>	Labels <a class="type" href="/builtin#int">int</a> <span class="string">` + "``" + `</span> <span class="comment">/* 137-byte string literal not displayed */</span>
 	<span class="comment">// contains filtered or unexported fields</span>
 }`,
 		},
 		{
 			name:   "filtered comment",
 			symbol: "FieldTagFiltered",
-			want: `type FieldTagFiltered struct {
-<span id="FieldTagFiltered.Name" data-kind="field">	Name <a href="/builtin#string">string</a> ` + "`tag`" + `
+			want: `<span class="keyword">type</span> <span class="type">FieldTagFiltered</span> <span class="keyword">struct</span> {
+<span id="FieldTagFiltered.Name" data-kind="field">	Name <a class="type" href="/builtin#string">string</a> <span class="string">` + "`tag`" + `</span>
 </span>	<span class="comment">// contains filtered or unexported fields</span>
 }`,
 		},
@@ -315,9 +443,22 @@ b := 2 /* another comment */
 `,
 			`
 <pre class="Documentation-exampleCode">
-a := 1
+a := <span class="number">1</span>
 <span class="comment">// a comment</span>
-b := 2 <span class="comment">/* another comment */</span>
+b := <span class="number">2</span> <span class="comment">/* another comment */</span>
+</pre>`,
+		},
+		{
+			"multi-line comment ending a line",
+			`a := 1 /* a multi-line
+comment */
+b := 2
+`,
+			`
+<pre class="Documentation-exampleCode">
+a := <span class="number">1</span> <span class="comment">/* a multi-line
+comment */</span>
+b := <span class="number">2</span>
 </pre>`,
 		},
 		{
@@ -328,7 +469,7 @@ b := 2 <span class="comment">/* another comment */</span>
 `,
 			`
 <pre class="Documentation-exampleCode">
-a := 1
+a := <span class="number">1</span>
 </pre>`,
 		},
 		{
@@ -341,9 +482,9 @@ b := 1
 `,
 			`
 <pre class="Documentation-exampleCode">
-a := 1
+a := <span class="number">1</span>
 <span class="comment">// Output:</span>
-b := 1
+b := <span class="number">1</span>
 </pre>
 `,
 		},
@@ -359,14 +500,14 @@ cleanup()
 `,
 			`
 <pre class="Documentation-exampleCode">
-a := 1
+a := <span class="number">1</span>
 <span class="comment">// Output:</span>
-b := 1
+b := <span class="number">1</span>
 </pre>
 `,
 		},
 	} {
-		out := codeHTML(test.in, legacyExampleTmpl)
+		out := codeHTML(test.in, legacyExampleTmpl, nil)
 		got := strings.TrimSpace(string(out.String()))
 		want := strings.TrimSpace(test.want)
 		if got != want {
@@ -375,6 +516,30 @@ b := 1
 	}
 }
 
+func TestCodeHTMLLinks(t *testing.T) {
+	idr := &identifierResolver{newPackageIDs(pkgIO, pkgOS), newDeclIDs(nil), nil}
+	src := `f, err := os.Open("io.Copy") // os.Open
+n, err := io.Copy(w, f)
+x.os.Open()
+os.Missing()
+os .Open()
+var r io.Reader = f.(os.File) // int
+`
+	want := `
+<pre class="Documentation-exampleCode">
+f, err := <a href="/os">os</a>.<a href="/os#Open">Open</a>(<span class="string">&#34;io.Copy&#34;</span>) <span class="comment">// os.Open</span>
+n, err := <a href="/io">io</a>.<a href="#Copy">Copy</a>(w, f)
+x.os.Open()
+os.Missing()
+os .Open()
+<span class="keyword">var</span> r <a href="/io">io</a>.<a class="type" href="#Reader">Reader</a> = f.(<a href="/os">os</a>.<a class="type" href="/os#File">File</a>) <span class="comment">// int</span>
+</pre>`
+	got := codeHTML(src, legacyExampleTmpl, idr).String()
+	if strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("codeHTML:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 func mustParse(t *testing.T, fset *token.FileSet, filename, src string) *ast.File {
 	t.Helper()
 	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
@@ -11,6 +11,7 @@ import (
 	"go/ast"
 	"go/token"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -32,6 +33,9 @@ type Renderer struct {
 	disableHotlinking bool
 	disablePermalinks bool
 	enableCommandTOC  bool
+	enableSections    bool
+	enableLists       bool
+	docLinkStyle      DocLinkStyle
 	ctx               context.Context
 	docTmpl           *template.Template
 	exampleTmpl       *template.Template
@@ -73,16 +77,64 @@ type Options struct {
 	//
 	// Only relevant for HTML formatting.
 	EnableInteractivePlayground bool
+
+	// EnableSections turns on support for explicit "# Heading" syntax
+	// and nested section headings. Package documentation with headings
+	// is rendered with a table of contents.
+	// See https://golang.org/issue/44447.
+	//
+	// Only relevant for HTML formatting.
+	EnableSections bool
+
+	// EnableLists turns on support for bulleted and numbered lists.
+	// A span of indented lines where the first line begins with a list
+	// marker (e.g., "-", "*", "+", "•", "1.", or "1)") is formatted as a list,
+	// provided that every other line either begins with a list marker
+	// or is indented further than the markers.
+	// See https://golang.org/issue/7873.
+	//
+	// Only relevant for HTML formatting.
+	EnableLists bool
+
+	// DocLinkStyle specifies the syntax of explicitly delimited references
+	// to Go identifiers and packages (e.g., "[io.Reader]"),
+	// which are converted into links even if hotlinking is disabled.
+	// See https://golang.org/issue/45533.
+	//
+	// Only relevant for HTML formatting.
+	DocLinkStyle DocLinkStyle
 }
 
+// DocLinkStyle is the syntax used to delimit doc links.
+type DocLinkStyle int
+
+const (
+	// NoDocLinks disables support for delimited doc links.
+	NoDocLinks DocLinkStyle = iota
+	// BracketDocLinks delimits doc links with brackets (e.g., "[io.Reader]").
+	BracketDocLinks
+	// BacktickDocLinks delimits doc links with backticks (e.g., "`io.Reader`").
+	// The links are formatted in code font.
+	BacktickDocLinks
+	// BackquoteDocLinks delimits doc links with a backtick and single quote
+	// (e.g., "`io.Reader'"). The links are formatted in code font.
+	BackquoteDocLinks
+)
+
 // docDataTmpl renders documentation. It expects a docData.
 var docDataTmpl = template.Must(template.New("").Parse(`
-{{- if and .EnableCommandTOC .Elements -}}
+{{- if .EnableTOC -}}
 	<div role="navigation" aria-label="Table of Contents">
 		<ul class="Documentation-toc">
 			{{- range .Elements -}}
 				{{- if .IsHeading -}}
+					{{- if eq .Level 3 -}}
+					<li class="Documentation-tocItem Documentation-tocItem--level3">
+					{{- else if eq .Level 2 -}}
+					<li class="Documentation-tocItem Documentation-tocItem--level2">
+					{{- else -}}
 					<li class="Documentation-tocItem">
+					{{- end -}}
 						<a href="#{{.ID}}">{{.Title}}</a>
 					</li>
 				{{- end -}}
@@ -92,11 +144,31 @@ var docDataTmpl = template.Must(template.New("").Parse(`
 {{- end -}}
 {{- range .Elements -}}
   {{- if .IsHeading -}}
+    {{- if eq .Level 3 -}}
+    <h6 id="{{.ID}}">{{.Title}}
+    {{- if not $.DisablePermalinks}} <a class="Documentation-idLink" href="#{{.ID}}">¶</a>{{end -}}
+    </h6>
+    {{- else if eq .Level 2 -}}
+    <h5 id="{{.ID}}">{{.Title}}
+    {{- if not $.DisablePermalinks}} <a class="Documentation-idLink" href="#{{.ID}}">¶</a>{{end -}}
+    </h5>
+    {{- else -}}
     <h4 id="{{.ID}}">{{.Title}}
     {{- if not $.DisablePermalinks}} <a class="Documentation-idLink" href="#{{.ID}}">¶</a>{{end -}}
     </h4>
+    {{- end}}
   {{else if .IsPreformat -}}
     <pre>{{.Body}}</pre>
+  {{- else if .IsList -}}
+    {{- if .IsOrdered -}}
+    <ol{{if ne .Start 1}} start="{{.Start}}"{{end}}>
+      {{- range .Items}}<li>{{.}}</li>{{end -}}
+    </ol>
+    {{- else -}}
+    <ul>
+      {{- range .Items}}<li>{{.}}</li>{{end -}}
+    </ul>
+    {{- end -}}
   {{- else -}}
     <p>{{.Body}}</p>
   {{- end -}}
@@ -106,8 +178,10 @@ var docDataTmpl = template.Must(template.New("").Parse(`
 var legacyExampleTmpl = template.Must(template.New("").Parse(`
 <pre class="Documentation-exampleCode">
 {{range .}}
-  {{- if .Comment -}}
-    <span class="comment">{{.Text}}</span>
+  {{- if .Href -}}
+    <a {{with .Class}}class="{{.}}" {{end}}href="{{.Href}}">{{.Text}}</a>
+  {{- else if .Class -}}
+    <span class="{{.Class}}">{{.Text}}</span>
   {{- else -}}
     {{.Text}}
   {{- end -}}
@@ -116,6 +190,8 @@ var legacyExampleTmpl = template.Must(template.New("").Parse(`
 `))
 
 // exampleTmpl renders code for an example. It expect an Example.
+// The text of a textarea cannot contain markup, so links and highlighting
+// are omitted.
 var exampleTmpl = template.Must(template.New("").Parse(`
 <textarea class="Documentation-exampleCode" spellcheck="false">
 {{range .}}
@@ -130,6 +206,9 @@ func New(ctx context.Context, fset *token.FileSet, pkg *doc.Package, opts *Optio
 	var disableHotlinking bool
 	var disablePermalinks bool
 	var enableCommandTOC bool
+	var enableSections bool
+	var enableLists bool
+	var docLinkStyle DocLinkStyle
 	exampleTemplate := legacyExampleTmpl
 	if opts != nil {
 		if len(opts.RelatedPackages) > 0 {
@@ -141,6 +220,9 @@ func New(ctx context.Context, fset *token.FileSet, pkg *doc.Package, opts *Optio
 		disableHotlinking = opts.DisableHotlinking
 		disablePermalinks = opts.DisablePermalinks
 		enableCommandTOC = opts.EnableCommandTOC
+		enableSections = opts.EnableSections
+		enableLists = opts.EnableLists
+		docLinkStyle = opts.DocLinkStyle
 		if opts.EnableInteractivePlayground {
 			exampleTemplate = exampleTmpl
 		}
@@ -154,6 +236,9 @@ func New(ctx context.Context, fset *token.FileSet, pkg *doc.Package, opts *Optio
 		disableHotlinking: disableHotlinking,
 		disablePermalinks: disablePermalinks,
 		enableCommandTOC:  enableCommandTOC,
+		enableSections:    enableSections,
+		enableLists:       enableLists,
+		docLinkStyle:      docLinkStyle,
 		docTmpl:           docDataTmpl,
 		exampleTmpl:       exampleTemplate,
 		ctx:               ctx,
@@ -182,16 +267,26 @@ func (r *Renderer) Synopsis(n ast.Node) string {
 // letter, and contains no punctuation is formatted as a heading.
 //
 // A span of indented lines is converted into a <pre> block, with the common
-// indent prefix removed.
+// indent prefix removed. If lists are enabled, a span of indented lines
+// that begins with a list marker is instead converted into a <ul> or <ol> block.
+//
+// If sections are enabled, a single line span of the form "# Title",
+// "## Title", or "### Title" is formatted as a heading of the given level.
+// The ID of a nested heading is prefixed by the IDs of its parent headings.
 //
 // URLs in the comment text are converted into links. Any word that matches
 // an exported top-level identifier in the package is automatically converted
 // into a hyperlink to the declaration of that identifier.
+// If doc links are enabled, a delimited reference to an identifier or package
+// (e.g., "[io.Reader]" or "[encoding/json.Decoder]") is converted into a link
+// with the delimiters removed. Links delimited by backticks are wrapped
+// in a <code> element.
 //
 // This returns formatted HTML with:
 //	<p>                elements for plain documentation text
 //	<pre>              elements for preformatted text
-//	<h3 id="hdr-XXX">  elements for headings with the "id" attribute
+//	<ul> and <ol>      elements for lists
+//	<h4 id="hdr-XXX">  elements for headings with the "id" attribute
 //	<a href="XXX">     elements for URL hyperlinks
 //
 // DocHTML is intended for documentation for the package and examples.
@@ -244,13 +339,14 @@ func (r *Renderer) CodeHTML(ex *doc.Example) safehtml.HTML {
 	return r.codeHTML(ex)
 }
 
-// block is (*heading | *paragraph | *preformat).
+// block is (*heading | *paragraph | *preformat | *list).
 type block interface{}
 
 type (
 	lines   []string
 	heading struct {
 		title string
+		level int // 1 for top-level headings
 	}
 	paragraph struct {
 		lines lines
@@ -258,17 +354,36 @@ type (
 	preformat struct {
 		lines lines
 	}
+	list struct {
+		ordered bool
+		start   int // number of the first item if ordered
+		items   []lines
+	}
 )
 
+// maxHeadingLevel is the maximum nesting depth of explicit headings.
+const maxHeadingLevel = 3
+
+// syntaxOptions controls which experimental doc comment syntax
+// is recognized by docToBlocks.
+type syntaxOptions struct {
+	sections bool // see https://golang.org/issue/44447
+	lists    bool // see https://golang.org/issue/7873
+}
+
 // docToBlocks converts doc string into list of blocks.
 //
 // Heading block is a non-blank line, surrounded by blank lines
 // and the next non-blank line is not indented.
+// If sections are enabled, a single non-blank line of the form "# Title"
+// is also a heading, where the number of '#' characters is the level.
 //
 // Preformat block contains single line or consecutive lines which have indent greater than 0.
+// If lists are enabled, a preformat block that begins with a list marker
+// is a list block instead.
 //
 // Paragraph block is a default block type if a block does not fall into heading and preformat.
-func docToBlocks(doc string) []block {
+func docToBlocks(doc string, opts syntaxOptions) []block {
 	docLines := unindent(strings.Split(strings.Trim(doc, "\n"), "\n"))
 
 	// Group the lines based on indentation and blank lines.
@@ -301,11 +416,19 @@ func docToBlocks(doc string) []block {
 			group = group[:len(group)-1] // remove trailing empty lines
 		}
 		_, wasHeading := lastBlk.(*heading)
+		title, level, isExplicit := explicitHeading(group[0])
 		switch {
 		case indentLength(group[0]) > 0:
-			blks = append(blks, &preformat{unindent(group)})
+			group = unindent(group)
+			if lst := parseList(group); opts.lists && lst != nil {
+				blks = append(blks, lst)
+			} else {
+				blks = append(blks, &preformat{group})
+			}
+		case opts.sections && len(group) == 1 && isExplicit:
+			blks = append(blks, &heading{title, level})
 		case i != 0 && !wasHeading && len(group) == 1 && isHeading(group[0]) && willParagraph:
-			blks = append(blks, &heading{group[0]})
+			blks = append(blks, &heading{group[0], 1})
 		default:
 			blks = append(blks, &paragraph{group})
 		}
@@ -346,6 +469,71 @@ func unindent(lines []string) []string {
 	return lines
 }
 
+// parseList parses a group of unindented lines as a list.
+// The first line must begin with a list marker, which determines
+// whether the list is ordered. Every line that begins with a list marker
+// starts a new item, while all other lines are a continuation of the
+// previous item and must be indented further than the markers.
+// It returns nil if the group is not a list (e.g., preformatted text
+// that contains lines resembling list items, such as a diff).
+func parseList(group []string) *list {
+	n, ordered := listMarker(group[0])
+	if n == 0 {
+		return nil
+	}
+	lst := &list{ordered: ordered}
+	if ordered {
+		lst.start, _ = strconv.Atoi(strings.TrimRight(group[0][:n], ".)"))
+	}
+	for _, line := range group {
+		if n, _ := listMarker(line); n > 0 {
+			lst.items = append(lst.items, lines{trimIndent(line[n:])})
+		} else if line != "" && indentLength(line) == 0 {
+			return nil // unindented text that is not an item
+		} else if line = trimIndent(line); line != "" {
+			lst.items[len(lst.items)-1] = append(lst.items[len(lst.items)-1], line)
+		}
+	}
+	return lst
+}
+
+// listMarker reports the length of the list marker at the start of line and
+// whether it is a numbered marker. Bullet markers are "-", "*", "+", and "•",
+// while numbered markers are a decimal number followed by "." or ")".
+// A marker must be followed by a space or tab.
+func listMarker(line string) (n int, ordered bool) {
+	switch {
+	case strings.HasPrefix(line, "•"):
+		n = len("•")
+	case strings.HasPrefix(line, "-") || strings.HasPrefix(line, "*") || strings.HasPrefix(line, "+"):
+		n = len("-")
+	default:
+		for n < len(line) && '0' <= line[n] && line[n] <= '9' {
+			n++
+		}
+		if n == 0 || n > 9 || n == len(line) || (line[n] != '.' && line[n] != ')') {
+			return 0, false
+		}
+		n++
+		ordered = true
+	}
+	if n == len(line) || (line[n] != ' ' && line[n] != '\t') {
+		return 0, false
+	}
+	return n, ordered
+}
+
+// explicitHeading reports whether line is an explicit heading of the form
+// "# Title", where the number of '#' characters is the heading level.
+func explicitHeading(line string) (title string, level int, ok bool) {
+	level = len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > maxHeadingLevel || level == len(line) || line[level] != ' ' {
+		return "", 0, false
+	}
+	title = strings.TrimSpace(line[level:])
+	return title, level, title != ""
+}
+
 // isHeading returns bool of if it passes as a section heading or not.
 // This is the copy of the heading function from the standard library.
 // https://go.googlesource.com/go/+/refs/tags/go1.16/src/go/doc/comment.go#212
@@ -54,6 +54,7 @@ func mustLoadPackage(path string) (*doc.Package, *token.FileSet) {
 func TestDocToBlocks(t *testing.T) {
 	tests := []struct {
 		in   string
+		opts syntaxOptions
 		want []block
 	}{{
 		in:   `This is a sentence.`,
@@ -96,7 +97,7 @@ func TestDocToBlocks(t *testing.T) {
 				"The quick brown fox jumped over the lazy dog.",
 				"This is another sentence. La de dah!",
 			}},
-			&heading{"This is a heading"},
+			&heading{"This is a heading", 1},
 			&paragraph{lines{"This is a paragraph."}},
 		},
 	}, {
@@ -178,7 +179,7 @@ func TestDocToBlocks(t *testing.T) {
 			means that the loop ran 10000000 times at a speed of 282 ns per loop.`,
 		want: []block{
 			&paragraph{lines{"Package testing provides support for automated testing of Go packages."}},
-			&heading{"Benchmarks"},
+			&heading{"Benchmarks", 1},
 			&paragraph{lines{"Functions of the form"}},
 			&preformat{lines{"func BenchmarkXxx(*testing.B)"}},
 			&paragraph{lines{
@@ -216,14 +217,119 @@ func TestDocToBlocks(t *testing.T) {
 			A module is a collection of packages that are released, versioned, and distributed together. Modules may be downloaded directly from version control repositories or from module proxy servers.`,
 		want: []block{
 			&paragraph{lines{"See https://golang.org/s/go14customimport for details."}},
-			&heading{"Modules, module versions, and more"},
+			&heading{"Modules, module versions, and more", 1},
 			&paragraph{lines{"Modules are how Go manages dependencies."}},
 			&paragraph{lines{"A module is a collection of packages that are released, versioned, and distributed together. Modules may be downloaded directly from version control repositories or from module proxy servers."}},
 		},
+	}, {
+		in: `
+			# Not a heading
+
+			Package comment.
+
+			# Heading
+
+			## Sub-heading
+			Not a heading since this is the same span.
+
+			#### Too deep
+
+			    # Not a heading`,
+		want: []block{
+			&paragraph{lines{"# Not a heading"}},
+			&paragraph{lines{"Package comment."}},
+			&paragraph{lines{"# Heading"}},
+			&paragraph{lines{"## Sub-heading", "Not a heading since this is the same span."}},
+			&paragraph{lines{"#### Too deep"}},
+			&preformat{lines{"# Not a heading"}},
+		},
+	}, {
+		in: `
+			# Heading
+
+			Package comment.
+
+			# Heading
+
+			## Sub-heading
+
+			###Not a heading
+
+			#### Too deep
+
+			Implicit heading
+
+			More text.
+
+			    # Not a heading`,
+		opts: syntaxOptions{sections: true},
+		want: []block{
+			&heading{"Heading", 1},
+			&paragraph{lines{"Package comment."}},
+			&heading{"Heading", 1},
+			&heading{"Sub-heading", 2},
+			&paragraph{lines{"###Not a heading"}},
+			&paragraph{lines{"#### Too deep"}},
+			&heading{"Implicit heading", 1},
+			&paragraph{lines{"More text."}},
+			&preformat{lines{"# Not a heading"}},
+		},
+	}, {
+		in: `
+			Not lists:
+			  - item
+			  text`,
+		want: []block{
+			&paragraph{lines{"Not lists:"}},
+			&preformat{lines{"- item", "text"}},
+		},
+	}, {
+		in: `
+			Bulleted list:
+			  - first item
+			  - second item
+			    that wraps
+
+			  • third item
+			Numbered list:
+			  3. third
+			  4) fourth
+			Not a list:
+			  -not a marker
+			  - item`,
+		opts: syntaxOptions{lists: true},
+		want: []block{
+			&paragraph{lines{"Bulleted list:"}},
+			&list{items: []lines{{"first item"}, {"second item", "that wraps"}, {"third item"}}},
+			&paragraph{lines{"Numbered list:"}},
+			&list{ordered: true, start: 3, items: []lines{{"third"}, {"fourth"}}},
+			&paragraph{lines{"Not a list:"}},
+			&preformat{lines{"-not a marker", "- item"}},
+		},
+	}, {
+		in: `
+			A diff:
+			  - removed line
+			  + added line
+			  unchanged line
+			Program output:
+			  1. first
+			  2. second
+
+			  total: 2
+			done`,
+		opts: syntaxOptions{lists: true},
+		want: []block{
+			&paragraph{lines{"A diff:"}},
+			&preformat{lines{"- removed line", "+ added line", "unchanged line"}},
+			&paragraph{lines{"Program output:"}},
+			&preformat{lines{"1. first", "2. second", "", "total: 2"}},
+			&paragraph{lines{"done"}},
+		},
 	}}
 
 	for i, tt := range tests {
-		got := docToBlocks(tt.in)
+		got := docToBlocks(tt.in, tt.opts)
 		if !reflect.DeepEqual(got, tt.want) {
 			t.Errorf("test %d, docToBlocks:\ngot  %v\nwant %v", i, got, tt.want)
 		}
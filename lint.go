@@ -0,0 +1,159 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+// lintExamples prints a diagnostic for every example in the packages
+// of the main modules that is not associated with any declaration.
+// It reports the number of such examples.
+func lintExamples(cfg *renderConfig) (numOrphaned int) {
+	wd, _ := os.Getwd()
+	cfg.root.walk(func(pkg *packageInfo) bool {
+		if len(pkg.files) == 0 || !cfg.documented(pkg) || pkg.module == nil || !pkg.module.Main {
+			return true
+		}
+		fset, files, err := pkg.parseFiles()
+		if err != nil {
+			log.Printf("unable to parse %q: %v", pkg.impPath, err)
+			return true
+		}
+		docPkg, err := pkg.newDoc(fset, files)
+		if err != nil {
+			log.Printf("unable to load documentation for %q: %v", pkg.impPath, err)
+			return true
+		}
+		for _, ex := range orphanedExamples(docPkg, files) {
+			numOrphaned++
+			if ex.Decl == nil {
+				fmt.Printf("%v: %v %v\n", pkg.impPath, ex.Name, ex.Message)
+				continue
+			}
+			pos := fset.PositionFor(ex.Decl.Pos(), false)
+			name := pos.Filename
+			if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+			fmt.Printf("%v:%d: %v %v\n", name, pos.Line, ex.Name, ex.Message)
+		}
+		return true
+	})
+	return numOrphaned
+}
+
+// orphanedExample is an example that is not associated with any declaration.
+type orphanedExample struct {
+	Name    string   // name of the example function (e.g., "ExampleFoo_Bar")
+	Message string   // explanation of why it is orphaned (e.g., "refers to unknown method Foo.Bar")
+	Decl    ast.Decl // declaration of the example function; nil if not found
+}
+
+// orphanedExamples returns the orphaned examples in docPkg,
+// where files are the parsed files that it was computed from.
+func orphanedExamples(docPkg *doc.Package, files []*ast.File) []orphanedExample {
+	if len(docPkg.OrphanedExamples) == 0 {
+		return nil
+	}
+	decls := make(map[string]*ast.FuncDecl)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && strings.HasPrefix(fd.Name.Name, "Example") {
+				decls[fd.Name.Name] = fd
+			}
+		}
+	}
+
+	// Collect the kind of every exported declaration that examples
+	// may refer to, keyed in the same way as by doc.NewFromFiles
+	// (e.g., "NewRing", "Ring", or "Ring_Len").
+	kinds := map[string]string{"": "package"}
+	addFunc := func(f *doc.Func) {
+		if token.IsExported(f.Name) {
+			kinds[f.Name] = "func"
+		}
+	}
+	for _, f := range docPkg.Funcs {
+		addFunc(f)
+	}
+	for _, t := range docPkg.Types {
+		if !token.IsExported(t.Name) {
+			continue
+		}
+		kinds[t.Name] = "type"
+		for _, f := range t.Funcs {
+			addFunc(f)
+		}
+		for _, m := range t.Methods {
+			if token.IsExported(m.Name) {
+				kinds[t.Name+"_"+m.Name] = "method"
+			}
+		}
+	}
+
+	var orphans []orphanedExample
+	for _, ex := range docPkg.OrphanedExamples {
+		name := "Example" + ex.Name
+		ox := orphanedExample{Name: name, Message: orphanMessage(ex.Name, kinds)}
+		if decl, ok := decls[name]; ok {
+			ox.Decl = decl
+		}
+		orphans = append(orphans, ox)
+	}
+	return orphans
+}
+
+// orphanMessage explains why the example with the given name
+// (without the "Example" prefix) is not associated with any declaration,
+// where kinds is the kind of every declaration that it may refer to.
+//
+// Since names are ambiguous (e.g., "Foo_Bar" may refer to a method Foo.Bar
+// or to Foo with a malformed "Bar" suffix), it reports the most likely cause
+// based on the longest prefix of the name that refers to a declaration.
+func orphanMessage(name string, kinds map[string]string) string {
+	for i := len(name); i >= 0; i = strings.LastIndexByte(name[:i], '_') {
+		kind, ok := kinds[name[:i]]
+		if !ok || i == len(name) {
+			continue
+		}
+		rest := name[i+len("_"):]
+		switch {
+		case rest == "":
+			return "has an empty suffix"
+		case kind == "type" && !isExampleSuffix(rest):
+			// Types are the only declarations with members,
+			// so an upper-case name is likely a method.
+			method := rest
+			if j := strings.IndexByte(method, '_'); j >= 0 {
+				method = method[:j]
+			}
+			return fmt.Sprintf("refers to unknown method %v.%v", name[:i], method)
+		default:
+			return fmt.Sprintf("has malformed suffix %q, which must start with a lower-case letter", rest)
+		}
+	}
+	id := name
+	if j := strings.IndexByte(id, '_'); j >= 0 {
+		id = id[:j]
+	}
+	return fmt.Sprintf("refers to unknown function or type %v", id)
+}
+
+// isExampleSuffix reports whether s is a valid example suffix.
+func isExampleSuffix(s string) bool {
+	r, size := utf8.DecodeRuneInString(s)
+	return size > 0 && unicode.IsLower(r)
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+func TestOrphanedExamples(t *testing.T) {
+	const src = `package p
+
+func Func() {}
+
+type Type int
+
+func NewType() Type { return 0 }
+
+func (Type) Method() {}
+
+type Type_Foo int
+
+func unexported() {}
+`
+	tests := []struct {
+		name string // name of the example function
+		want string // expected message, or empty if not orphaned
+	}{
+		// Examples that are associated with a declaration,
+		// or that are not examples at all.
+		{name: "Example"},
+		{name: "Example_suffix"},
+		{name: "Example_suffix_Upper"},
+		{name: "ExampleFunc"},
+		{name: "ExampleNewType_suffix"},
+		{name: "ExampleType_Method"},
+		{name: "ExampleType_Foo"},
+		{name: "ExampleType_Foo_suffix"},
+		{name: "Exampleunexported"},
+
+		// Unknown function or type.
+		{name: "ExampleMissing", want: "refers to unknown function or type Missing"},
+		{name: "ExampleMissing_suffix", want: "refers to unknown function or type Missing"},
+
+		// Unknown method.
+		{name: "ExampleType_Missing", want: "refers to unknown method Type.Missing"},
+		{name: "ExampleType_Missing_suffix", want: "refers to unknown method Type.Missing"},
+		{name: "ExampleType_Foo_Missing", want: "refers to unknown method Type_Foo.Missing"},
+
+		// Upper-case suffix.
+		{name: "ExampleFunc_Suffix", want: `has malformed suffix "Suffix", which must start with a lower-case letter`},
+		{name: "ExampleType_Method_Suffix", want: `has malformed suffix "Suffix", which must start with a lower-case letter`},
+		{name: "ExampleType_Method_1", want: `has malformed suffix "1", which must start with a lower-case letter`},
+
+		// Package examples.
+		{name: "Example_", want: "has an empty suffix"},
+		{name: "Example_Suffix", want: `has malformed suffix "Suffix", which must start with a lower-case letter`},
+		{name: "ExampleFunc_", want: "has an empty suffix"},
+	}
+
+	var testSrc strings.Builder
+	testSrc.WriteString("package p_test\n")
+	for _, tt := range tests {
+		testSrc.WriteString("func " + tt.name + "() {}\n")
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, src := range map[string]string{"p.go": src, "p_test.go": testSrc.String()} {
+		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	docPkg, err := doc.NewFromFiles(fset, files, "example.com/p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, ex := range orphanedExamples(docPkg, files) {
+		if ex.Decl == nil {
+			t.Errorf("%v: missing declaration", ex.Name)
+		}
+		got[ex.Name] = ex.Message
+	}
+	for _, tt := range tests {
+		if got[tt.name] != tt.want {
+			t.Errorf("%v:\ngot  %q\nwant %q", tt.name, got[tt.name], tt.want)
+		}
+	}
+}
@@ -5,7 +5,6 @@
 package main
 
 import (
-	"archive/tar"
 	"bytes"
 	"flag"
 	"fmt"
@@ -14,7 +13,11 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
 	"strings"
+	"time"
+
+	"github.com/dsnet/godoc/internal/render"
 )
 
 func main() {
@@ -24,66 +27,192 @@ func main() {
 		"\tsections             https://golang.org/issue/44447\n"+
 		"\thotlinks             https://golang.org/issue/25444\n"+
 		"\thotlinks-bracket     https://golang.org/issue/45533 using brackets as delimiters\n"+
-		"\thotlinks-backtick    https://golang.org/issue/45533 using backticks and as delimiters\n"+
+		"\thotlinks-backtick    https://golang.org/issue/45533 using backticks as delimiters\n"+
 		"\thotlinks-backquote   https://golang.org/issue/45533 using a backtick and single quote as delimiters\n"+
+		"\thotlinks-verify      report delimited hotlinks that cannot be resolved instead of rendering\n"+
 		"\tlists                https://golang.org/issue/7873#issuecomment-820116651",
 	)
-	archive := flag.String("archive", "", "The output file for generated archive files. Specify '-' to output to stdout.")
+	archive := flag.String("archive", "", "The output file for a generated TAR archive. Specify '-' to output to stdout.\n"+
+		"This is equivalent to -out with -format=tar.")
+	out := flag.String("out", "", "The output path for generated files. Specify '-' to output to stdout.")
+	format := flag.String("format", "", "The format of the -out output, which is one of \"tar\", \"zip\", or \"dir\".\n"+
+		"If unspecified, it is chosen by the file extension of the output path,\n"+
+		"where a path without a \".tar\" or \".zip\" extension is a directory.")
+	incremental := flag.String("incremental", "", "A previous output to copy pages from for packages whose inputs are unchanged,\n"+
+		"as recorded in the manifest of the previous output. It may be the same as the output.\n"+
+		"Its format is chosen by its file extension in the same way as for -out.")
+	verifyExamples := flag.Bool("verify-examples", false, "Whether to run the examples of packages in the main module with 'go test',\n"+
+		"annotating each example with whether its output matched and, when generating output,\n"+
+		"reporting the examples that failed. Examples that fail cause a non-zero exit status.")
+	orphans := flag.Bool("orphaned-examples", false, "Whether package pages list the examples that are not associated with any declaration\n"+
+		"(e.g., because of a malformed name or a renamed declaration), which are otherwise not shown.")
+	lint := flag.Bool("lint", false, "Report the examples in the main module that are not associated with any declaration\n"+
+		"along with their file positions instead of rendering.")
+	siteURL := flag.String("site-url", "", "The URL that the root of the generated output is hosted at (e.g., \"https://example.com\"),\n"+
+		"which is used to form absolute locations in the generated sitemap.xml as required by search engines.\n"+
+		"If empty, the locations are relative to the root of the output.")
+	relativeLinks := flag.Bool("relative-links", false, "Whether generated files link to each other using relative URLs,\n"+
+		"so that the output can be hosted under any path or browsed directly from the file system.")
+	basePath := flag.String("base-path", "/", "The URL path under which pages are served or generated (e.g., \"/docs/go/\").\n"+
+		"All links are prefixed by it and, in serve mode, it is stripped from every request.")
+	jobs := flag.Int("j", runtime.GOMAXPROCS(0), "The number of packages to render concurrently when generating output.")
 	address := flag.String("address", "0.0.0.0:8080", "The address to serve GoDoc on.")
+	play := flag.Bool("playground", false, "Whether examples are editable and runnable in serve mode, which requires a loopback -address.\n"+
+		"Programs are built and run locally with the privileges of the server and are not sandboxed.")
+	poll := flag.Duration("poll", time.Second, "The interval at which to poll for changes to source files in serve mode.\n"+
+		"Changed packages are reloaded and open pages are refreshed. Specify 0 to disable.")
+	goos := flag.String("goos", "", "The GOOS to render packages for. Defaults to the host GOOS.")
+	goarch := flag.String("goarch", "", "The GOARCH to render packages for. Defaults to the host GOARCH.")
+	tags := flag.String("tags", "", "A comma separated list of build tags to consider satisfied.")
+	platforms := flag.String("platforms", "", "A comma separated list of GOOS/GOARCH pairs (e.g., \"linux/amd64,windows/amd64\").\n"+
+		"If specified, packages are rendered as the union of declarations across all platforms,\n"+
+		"where declarations not present on every platform are annotated with the platforms they exist on.")
+	deps := flag.Bool("deps", true, "Whether to also document the transitive dependencies of the packages matching the patterns.")
+	externalURL := flag.String("external-url", "https://pkg.go.dev/", "The base URL to link to for packages that are not documented.\n"+
+		"If empty, such packages are linked to as if they were documented.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [packages]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "The packages are specified as patterns understood by `go list`.\n"+
+			"If none are specified, it defaults to \"all\", or \"./...\" if -deps=false.\n\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	opts := render.Options{DisableHotlinking: true}
+	var verifyHotlinks bool
 	for _, experiment := range strings.Split(*experiments, ",") {
 		switch experiment {
 		case "":
 		case "sections":
-			log.Fatalf("%v not implemented", experiment)
+			opts.EnableSections = true
 		case "hotlinks":
-			log.Fatalf("%v not implemented", experiment)
-		case "hotlinks-bracket":
-			log.Fatalf("%v not implemented", experiment)
-		case "hotlinks-backtick":
-			log.Fatalf("%v not implemented", experiment)
-		case "hotlinks-backquote":
-			log.Fatalf("%v not implemented", experiment)
+			opts.DisableHotlinking = false
+		case "hotlinks-bracket", "hotlinks-backtick", "hotlinks-backquote":
+			if opts.DocLinkStyle != render.NoDocLinks {
+				log.Fatalf("%v cannot be combined with other delimited hotlinks", experiment)
+			}
+			opts.DocLinkStyle = map[string]render.DocLinkStyle{
+				"hotlinks-bracket":   render.BracketDocLinks,
+				"hotlinks-backtick":  render.BacktickDocLinks,
+				"hotlinks-backquote": render.BackquoteDocLinks,
+			}[experiment]
 		case "hotlinks-verify":
-			log.Fatalf("%v not implemented", experiment)
+			verifyHotlinks = true
 		case "lists":
-			log.Fatalf("%v not implemented", experiment)
+			opts.EnableLists = true
 		default:
 			log.Fatalf("unknown experimental feature: %v", experiment)
 		}
 	}
+	if verifyHotlinks && opts.DocLinkStyle == render.NoDocLinks {
+		log.Fatal("hotlinks-verify requires one of hotlinks-bracket, hotlinks-backtick, or hotlinks-backquote")
+	}
 
-	// Construct a tree of all packages.
-	root, err := loadPackages("all")
-	if err != nil {
-		log.Fatalf("unable to load all packages: %v", err)
+	var buildTags []string
+	if *tags != "" {
+		buildTags = strings.Split(*tags, ",")
+	}
+	bctxs := []buildContext{{goos: *goos, goarch: *goarch, tags: buildTags}}
+	if *platforms != "" {
+		if *goos != "" || *goarch != "" {
+			log.Fatal("-platforms cannot be combined with -goos or -goarch")
+		}
+		var err error
+		bctxs, err = parsePlatforms(*platforms, buildTags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"all"}
+		if !*deps {
+			patterns = []string{"./..."}
+		}
 	}
 
 	if *archive != "" {
-		if *archive == "" {
-			log.Fatal("unknown output, please specify the '-archive' flag")
+		if *out != "" {
+			log.Fatal("-archive cannot be combined with -out")
 		}
+		*out, *format = *archive, formatTar
+	}
+	if *incremental != "" && *out == "" {
+		log.Fatal("-incremental requires -out or -archive")
+	}
+	if *play {
+		if *out != "" {
+			log.Fatal("-playground cannot be combined with -out or -archive")
+		}
+		if !isLoopbackHost(*address) {
+			log.Fatal("-playground requires a loopback -address (e.g., localhost:8080)")
+		}
+		opts.EnableInteractivePlayground = true
+	}
+	// Examples are run with go test, which only runs them on the host platform.
+	if *verifyExamples && (*goos != "" || *goarch != "" || *platforms != "") {
+		log.Fatal("-verify-examples cannot be combined with -goos, -goarch, or -platforms")
+	}
+	if *relativeLinks && *out == "" {
+		log.Fatal("-relative-links requires -out or -archive")
+	}
+	*basePath = strings.TrimSuffix(path.Clean("/"+*basePath), "/")
+	if *relativeLinks && *basePath != "" {
+		log.Fatal("-relative-links cannot be combined with -base-path")
+	}
 
-		// Open the output archive file.
-		f := os.Stdout
-		if *archive != "-" {
-			f, err = os.OpenFile(*archive, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0664)
-			if err != nil {
-				log.Fatalf("os.OpenFile error: %v", err)
-			}
-			defer func() {
-				if err := f.Close(); err != nil {
-					log.Fatalf("os.File.Close error: %v", err)
-				}
-			}()
+	// Construct a tree of all requested packages and their dependencies.
+	root, err := loadPackages(patterns, bctxs)
+	if err != nil {
+		// In serve mode, the packages are reloaded once the problem is fixed.
+		if *out != "" || verifyHotlinks || *lint || *poll <= 0 {
+			log.Fatalf("unable to load packages: %v", err)
+		}
+		log.Printf("unable to load packages: %v", err)
+	}
+	cfg := &renderConfig{opts: opts, root: root, deps: *deps, externalURL: *externalURL, relativeLinks: *relativeLinks, orphanedExamples: *orphans, basePath: *basePath}
+	if len(bctxs) > 1 {
+		for _, bctx := range bctxs {
+			cfg.platforms = append(cfg.platforms, bctx.platform())
+		}
+	}
+	if *verifyExamples {
+		cfg.examples = &exampleVerifier{tags: buildTags}
+	}
+
+	if verifyHotlinks {
+		if n := verifyDocLinks(cfg); n > 0 {
+			log.Fatalf("found %d unresolved hotlinks", n)
 		}
-		tw := tar.NewWriter(f)
-		defer func() {
-			if err := tw.Close(); err != nil {
-				log.Fatalf("tar.Writer.Close error: %v", err)
+		return
+	}
+	if *lint {
+		if n := lintExamples(cfg); n > 0 {
+			log.Fatalf("found %d orphaned examples", n)
+		}
+		return
+	}
+
+	if *out != "" {
+		cfg.clientSearch = true
+
+		// The previous output must be read before it may be overwritten.
+		var prev outputReader
+		if *incremental != "" {
+			prev, err = openOutput(*incremental, "")
+			switch {
+			case os.IsNotExist(err):
+				log.Printf("previous output does not exist, rendering all packages")
+			case err != nil:
+				log.Fatalf("unable to open previous output: %v", err)
 			}
-		}()
+		}
+
+		ow, err := createOutput(*out, *format)
+		if err != nil {
+			log.Fatalf("unable to create output: %v", err)
+		}
 
 		// Iterate over static files.
 		for _, file := range []struct {
@@ -95,40 +224,46 @@ func main() {
 			{"code.js", codeJS},
 			{"style.css", styleCSS},
 		} {
-			hdr := &tar.Header{
-				Name: file.name,
-				Mode: 0664,
-				Size: int64(len(file.data)),
-			}
-			if err := tw.WriteHeader(hdr); err != nil {
-				log.Fatalf("tar.Writer.WriteHeader error: %v", err)
-			}
-			if _, err := tw.Write(file.data); err != nil {
-				log.Fatalf("tar.Writer.Write error: %v", err)
+			if err := ow.WriteFile(file.name, file.data); err != nil {
+				log.Fatal(err)
 			}
 		}
 
 		// Iterate over all packages.
-		var bb bytes.Buffer
+		var pkgs []*packageInfo
 		root.walk(func(pkg *packageInfo) bool {
-			log.Printf("rendering %q", pkg.impPath)
-			bb.Reset()
-			if err := pkg.renderHTML(&bb); err != nil {
-				log.Fatalf("packageInfo.renderHTML error: %v", err)
-			}
-			hdr := &tar.Header{
-				Name: path.Join(pkg.impPath, "index.html"),
-				Mode: 0664,
-				Size: int64(bb.Len()),
-			}
-			if err := tw.WriteHeader(hdr); err != nil {
-				log.Fatalf("tar.Writer.WriteHeader error: %v", err)
-			}
-			if _, err := tw.Write(bb.Bytes()); err != nil {
-				log.Fatalf("tar.Writer.Write error: %v", err)
+			if cfg.visible(pkg) {
+				pkgs = append(pkgs, pkg)
 			}
 			return true
 		})
+		pr := newPageRenderer(cfg, prev)
+		renderPackages(pkgs, *jobs, pr.render, func(pkg *packageInfo, files []renderedFile) {
+			for _, file := range files {
+				if err := ow.WriteFile(file.name, file.data); err != nil {
+					log.Fatal(err)
+				}
+			}
+		})
+		if err := ow.WriteFile("sitemap.xml", pr.sitemap(*siteURL, pkgs)); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("indexing packages for search")
+		if err := ow.WriteFile(searchIndexName, cfg.searchIndex(pr.searchEntries(pkgs))); err != nil {
+			log.Fatal(err)
+		}
+		if err := ow.WriteFile(manifestName, pr.manifest()); err != nil {
+			log.Fatal(err)
+		}
+		if err := ow.Close(); err != nil {
+			log.Fatal(err)
+		}
+
+		if cfg.examples != nil {
+			if n := cfg.examples.report(os.Stderr); n > 0 {
+				log.Fatalf("found %d failed examples", n)
+			}
+		}
 	} else {
 		// Best-effort attempt to get the current package or module.
 		b, _ := exec.Command("go", "list").Output()
@@ -137,10 +272,35 @@ func main() {
 			b, _ := exec.Command("go", "list", "-m").Output()
 			currentPath = strings.TrimSpace(string(b))
 		}
-		fmt.Printf("http://%v/%v\n\n", *address, currentPath)
+		fmt.Printf("http://%v%v/%v\n\n", *address, *basePath, currentPath)
+
+		cfg.liveReload = *poll > 0
+		cfg.serverSearch = true
+		pg := newPlayground()
+		if *play {
+			cfg.playgroundToken = pg.token
+		}
+		watch := newWatcher(cfg, patterns, bctxs, err != nil)
+		if *poll > 0 {
+			go watch.run(*poll)
+		}
+		cache := new(renderCache)
+		search := newSearcher()
+		go search.watch(watch)
 
 		log.Fatal(http.ListenAndServe(*address, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			switch r.URL.Path {
+			cfg := watch.config()
+			// Strip the base path from the request.
+			urlPath := strings.TrimPrefix(r.URL.Path, cfg.basePath)
+			if urlPath == "" {
+				urlPath = "/"
+			}
+			if len(urlPath) == len(r.URL.Path) && cfg.basePath != "" || urlPath[0] != '/' {
+				http.NotFound(w, r)
+				return
+			}
+
+			switch urlPath {
 			case "/favicon.ico":
 				w.Header().Set("Content-Type", "image/x-icon")
 				w.Write(faviconIco)
@@ -157,21 +317,104 @@ func main() {
 				w.Header().Set("Content-Type", "text/css; charset=utf-8")
 				w.Write(styleCSS)
 				return
+			case "/search":
+				query := r.FormValue("q")
+				log.Printf("searching for %q", query)
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if err := cfg.renderSearchHTML(w, query, search.search(cfg, query)); err != nil {
+					log.Printf("error rendering search results: %v", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			case "/compile", "/fmt":
+				if cfg.playgroundToken == "" {
+					http.NotFound(w, r)
+					return
+				}
+				if urlPath == "/compile" {
+					pg.serveCompile(w, r)
+				} else {
+					pg.serveFmt(w, r)
+				}
+				return
+			case "/reload":
+				// Notify the client with a server-sent event
+				// whenever the package tree is reloaded.
+				flusher, ok := w.(http.Flusher)
+				if !ok || !cfg.liveReload {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				flusher.Flush()
+				for {
+					select {
+					case <-watch.changes():
+						fmt.Fprint(w, "event: reload\ndata:\n\n")
+						flusher.Flush()
+					case <-r.Context().Done():
+						return
+					}
+				}
 			default:
-				pkg := root.resolve(strings.TrimPrefix(r.URL.Path, "/"))
-				if pkg == nil {
+				if pkg, name, ok := cfg.sourceFile(strings.TrimPrefix(urlPath, "/")); ok {
+					log.Printf("serving %q", path.Join(pkg.impPath, name))
+					var bb bytes.Buffer
+					if err := pkg.renderSourceHTML(&bb, cfg, name); err != nil {
+						log.Printf("error rendering %q: %v", path.Join(pkg.impPath, name), err)
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					w.Header().Set("Content-Type", "text/html; charset=utf-8")
+					w.Write(bb.Bytes())
+					return
+				}
+
+				pkg := cfg.root.resolve(strings.TrimPrefix(urlPath, "/"))
+				if pkg == nil || !cfg.visible(pkg) {
 					http.NotFound(w, r)
 					return
 				}
 
 				log.Printf("serving %q", pkg.impPath)
-				w.Header().Set("Content-Type", "text/html; charset=utf-8")
-				if err := pkg.renderHTML(w); err != nil {
+				page, err := cache.render(pkg, cfg)
+				if err != nil {
 					log.Printf("error rendering %q: %v", pkg.impPath, err)
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
+				page.ServeHTTP(w, r)
 			}
 		})))
 	}
 }
+
+// renderPackages renders the pages for every package using up to jobs
+// concurrent calls to render and calls emit with the rendered pages
+// for each package in the same order as pkgs.
+func renderPackages(pkgs []*packageInfo, jobs int, render func(*packageInfo) []renderedFile, emit func(*packageInfo, []renderedFile)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// The semaphore is only released once a rendered package is emitted,
+	// which bounds the number of rendered packages held in memory.
+	sem := make(chan struct{}, jobs)
+	results := make([]chan []renderedFile, len(pkgs))
+	for i := range results {
+		results[i] = make(chan []renderedFile, 1)
+	}
+	go func() {
+		for i, pkg := range pkgs {
+			sem <- struct{}{}
+			go func(pkg *packageInfo, result chan<- []renderedFile) {
+				result <- render(pkg)
+			}(pkg, results[i])
+		}
+	}()
+	for i, pkg := range pkgs {
+		emit(pkg, <-results[i])
+		<-sem
+	}
+}
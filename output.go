@@ -0,0 +1,229 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputWriter writes generated files to an output.
+type outputWriter interface {
+	// WriteFile writes a file with the given slash-separated name.
+	WriteFile(name string, data []byte) error
+	// Close flushes and closes the output.
+	Close() error
+}
+
+// outputReader reads files from a previously generated output.
+type outputReader interface {
+	// ReadFile reads the file with the given slash-separated name.
+	ReadFile(name string) ([]byte, error)
+}
+
+// Output formats supported by createOutput and openOutput.
+const (
+	formatTar = "tar"
+	formatZip = "zip"
+	formatDir = "dir"
+)
+
+// outputFormat returns the format for an output at the given path.
+// If the format is empty, it is chosen by the file extension of the path,
+// where anything other than a ".tar" or ".zip" file is a directory.
+// The path "-" specifies stdout, which defaults to the TAR format.
+func outputFormat(name, format string) string {
+	if format == "" {
+		switch {
+		case strings.HasSuffix(name, ".zip"):
+			format = formatZip
+		case strings.HasSuffix(name, ".tar"), name == "-":
+			format = formatTar
+		default:
+			format = formatDir
+		}
+	}
+	return format
+}
+
+// createOutput creates an output of the specified format at the given path.
+// See outputFormat for how the format is chosen if unspecified.
+func createOutput(name, format string) (outputWriter, error) {
+	format = outputFormat(name, format)
+	var f io.WriteCloser
+	switch format {
+	case formatTar, formatZip:
+		if name == "-" {
+			f = nopCloser{os.Stdout}
+		} else {
+			var err error
+			f, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0664)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case formatDir:
+		if name == "-" {
+			return nil, fmt.Errorf("cannot output a directory to stdout")
+		}
+		if err := os.MkdirAll(name, 0775); err != nil {
+			return nil, err
+		}
+		return dirOutput(name), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+
+	if format == formatZip {
+		return &zipOutput{zip.NewWriter(f), f}, nil
+	}
+	return &tarOutput{tar.NewWriter(f), f}, nil
+}
+
+// tarOutput writes files to a TAR archive.
+type tarOutput struct {
+	tw *tar.Writer
+	f  io.WriteCloser
+}
+
+func (o *tarOutput) WriteFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name: name,
+		Mode: 0664,
+		Size: int64(len(data)),
+	}
+	if err := o.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("tar.Writer.WriteHeader error: %w", err)
+	}
+	if _, err := o.tw.Write(data); err != nil {
+		return fmt.Errorf("tar.Writer.Write error: %w", err)
+	}
+	return nil
+}
+
+func (o *tarOutput) Close() error {
+	if err := o.tw.Close(); err != nil {
+		return fmt.Errorf("tar.Writer.Close error: %w", err)
+	}
+	return o.f.Close()
+}
+
+// zipOutput writes files to a ZIP archive.
+type zipOutput struct {
+	zw *zip.Writer
+	f  io.WriteCloser
+}
+
+func (o *zipOutput) WriteFile(name string, data []byte) error {
+	w, err := o.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return fmt.Errorf("zip.Writer.CreateHeader error: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("zip.Writer.Write error: %w", err)
+	}
+	return nil
+}
+
+func (o *zipOutput) Close() error {
+	if err := o.zw.Close(); err != nil {
+		return fmt.Errorf("zip.Writer.Close error: %w", err)
+	}
+	return o.f.Close()
+}
+
+// dirOutput writes files to a directory tree rooted at the given path.
+type dirOutput string
+
+func (o dirOutput) WriteFile(name string, data []byte) error {
+	name = filepath.Join(string(o), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(name), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0664)
+}
+
+func (o dirOutput) Close() error {
+	return nil
+}
+
+// openOutput opens a previously generated output of the specified format
+// at the given path. See outputFormat for how the format is chosen
+// if unspecified. Archives are read entirely into memory so that
+// the output may be overwritten while it is being read from.
+func openOutput(name, format string) (outputReader, error) {
+	switch format = outputFormat(name, format); format {
+	case formatTar:
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files := make(mapOutput)
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return files, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("tar.Reader.Next error: %w", err)
+			}
+			if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("tar.Reader.Read error: %w", err)
+			}
+		}
+	case formatZip:
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		files := make(mapOutput)
+		for _, zf := range zr.File {
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, fmt.Errorf("zip.File.Open error: %w", err)
+			}
+			files[zf.Name], err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("zip.File.Read error: %w", err)
+			}
+		}
+		return files, nil
+	case formatDir:
+		if _, err := os.Stat(name); err != nil {
+			return nil, err
+		}
+		return dirOutput(name), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func (o dirOutput) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(o), filepath.FromSlash(name)))
+}
+
+// mapOutput is an output read into memory, keyed by file name.
+type mapOutput map[string][]byte
+
+func (o mapOutput) ReadFile(name string) ([]byte, error) {
+	b, ok := o[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return b, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
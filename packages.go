@@ -1,228 +1,389 @@
-// Copyright 2021 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-package main
-
-import (
-	"bytes"
-	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
-	"io"
-	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
-	"sort"
-	"strconv"
-	"strings"
-
-	"github.com/dsnet/godoc/internal/doc"
-)
-
-type packageInfo struct {
-	name    string   // e.g., "tar"
-	impPath string   // e.g., "archive/tar"
-	dirPath string   // e.g., "/usr/local/go/src/archive/tar"
-	files   []string // e.g., ["reader.go", "reader_test.go", ...]
-
-	packages map[string]*packageInfo
-}
-
-// loadPackages loads all packages matching pattern and
-// returns a single root node representing the package tree.
-func loadPackages(pattern string) (*packageInfo, error) {
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("go", "list", "-f", `{{printf "%q %q %q %q %q %q %q" .Name .ImportPath .Dir .GoFiles .CgoFiles .TestGoFiles .XTestGoFiles}}`, pattern)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("execute `go list` error: %w\n%v", err, stderr)
-	}
-
-	// We need to know the pseudo-source for builtin declarations.
-	cmd = exec.Command("go", "list", "-f", `{{printf "%q %q %q %q %q %q %q" .Name .ImportPath .Dir .GoFiles .CgoFiles .TestGoFiles .XTestGoFiles}}`, "builtin")
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("execute `go list` error: %w\n%v", err, stderr)
-	}
-
-	root := new(packageInfo)
-	for {
-		line, err := stdout.ReadBytes('\n')
-		if err != nil && err != io.EOF {
-			return root, err
-		}
-		in := strings.TrimSuffix(string(line), "\n")
-		if len(in) == 0 || err == io.EOF {
-			break
-		}
-
-		var pkg packageInfo
-		in = strings.TrimLeft(in, " ")
-		pkg.name, in, err = unquotePrefix(in)
-		if err != nil {
-			return root, fmt.Errorf("unable to parse `go list` output: %w", err)
-		}
-		in = strings.TrimLeft(in, " ")
-		pkg.impPath, in, err = unquotePrefix(in)
-		if err != nil {
-			return root, fmt.Errorf("unable to parse `go list` output: %w", err)
-		}
-		in = strings.TrimLeft(in, " ")
-		pkg.dirPath, in, err = unquotePrefix(in)
-		if err != nil {
-			return root, fmt.Errorf("unable to parse `go list` output: %w", err)
-		}
-		in = strings.TrimLeft(in, "[] ")
-		for len(in) > 0 {
-			var file string
-			file, in, err = unquotePrefix(in)
-			if err != nil {
-				return root, fmt.Errorf("unable to parse `go list` output: %w", err)
-			}
-			pkg.files = append(pkg.files, file)
-			in = strings.TrimLeft(in, "[] ")
-		}
-		sort.Strings(pkg.files)
-		root.merge(pkg)
-	}
-	return root, nil
-}
-
-func (root *packageInfo) merge(pkg packageInfo) {
-	var dirName string
-	suffix := strings.TrimPrefix(strings.TrimPrefix(pkg.impPath, root.impPath), "/")
-	if i := strings.IndexByte(suffix, '/'); i >= 0 {
-		dirName, suffix = suffix[:i], suffix[i+len("/"):]
-	} else {
-		dirName, suffix = suffix, ""
-	}
-	child, ok := root.packages[dirName]
-	if !ok {
-		if root.packages == nil {
-			root.packages = make(map[string]*packageInfo)
-		}
-		child = &packageInfo{impPath: path.Join(root.impPath, dirName)}
-		root.packages[dirName] = child
-	}
-	if suffix == "" {
-		child.name = pkg.name
-		child.dirPath = pkg.dirPath
-		child.files = pkg.files
-	} else {
-		child.merge(pkg)
-	}
-}
-
-func (pkg *packageInfo) resolve(impPath string) *packageInfo {
-	for len(impPath) > 0 {
-		dirName := impPath
-		if i := strings.IndexByte(impPath, '/'); i >= 0 {
-			dirName, impPath = impPath[:i], impPath[i+len("/"):]
-		} else {
-			dirName, impPath = impPath, ""
-		}
-		pkg = pkg.packages[dirName]
-		if pkg == nil {
-			return nil
-		}
-	}
-	return pkg
-}
-
-func (pkg *packageInfo) walk(visit func(*packageInfo) bool) bool {
-	if !visit(pkg) {
-		return false
-	}
-	var names []string
-	for name := range pkg.packages {
-		names = append(names, name)
-	}
-	sort.Strings(names)
-	for _, name := range names {
-		if !pkg.packages[name].walk(visit) {
-			return false
-		}
-	}
-	return true
-}
-
-func (pkg *packageInfo) loadDoc() (*token.FileSet, *doc.Package, error) {
-	if len(pkg.files) == 0 {
-		return nil, nil, fmt.Errorf("no files present for %q", pkg.impPath)
-	}
-	fset := token.NewFileSet()
-	var files []*ast.File
-	for _, name := range pkg.files {
-		name = filepath.Join(pkg.dirPath, name)
-		src, err := os.ReadFile(name)
-		if err != nil {
-			return nil, nil, err
-		}
-		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
-		if err != nil {
-			return nil, nil, err
-		}
-		files = append(files, file)
-	}
-
-	var noFiltering, noTypeAssociation bool
-	if pkg.impPath == "builtin" {
-		noFiltering = true
-		noTypeAssociation = true
-	}
-
-	var m doc.Mode
-	if noFiltering {
-		m |= doc.AllDecls
-	}
-	docPkg, err := doc.NewFromFiles(fset, files, pkg.impPath, m)
-	if noTypeAssociation {
-		for _, t := range docPkg.Types {
-			docPkg.Consts, t.Consts = append(docPkg.Consts, t.Consts...), nil
-			docPkg.Vars, t.Vars = append(docPkg.Vars, t.Vars...), nil
-			docPkg.Funcs, t.Funcs = append(docPkg.Funcs, t.Funcs...), nil
-		}
-		sort.Slice(docPkg.Funcs, func(i, j int) bool { return docPkg.Funcs[i].Name < docPkg.Funcs[j].Name })
-	}
-	return fset, docPkg, err
-}
-
-func unquotePrefix(in string) (out, rem string, err error) {
-	n := quotedPrefixLen(in)
-	out, err = strconv.Unquote(in[:n])
-	return out, in[n:], err
-}
-
-// quotedPrefixLen returns the length of a quoted string at the start of s.
-// See http://golang.org/issue/45033.
-func quotedPrefixLen(s string) int {
-	if len(s) == 0 {
-		return len(s)
-	}
-	switch s[0] {
-	case '`':
-		for i, r := range s[len("`"):] {
-			if r == '`' {
-				return len("`") + i + len("`")
-			}
-		}
-	case '"':
-		var inEscape bool
-		for i, r := range s[len(`"`):] {
-			switch {
-			case inEscape:
-				inEscape = false
-			case r == '\\':
-				inEscape = true
-			case r == '"':
-				return len(`"`) + i + len(`"`)
-			}
-		}
-	}
-	return len(s)
-}
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+type packageInfo struct {
+	name    string   // e.g., "tar"
+	impPath string   // e.g., "archive/tar"
+	dirPath string   // e.g., "/usr/local/go/src/archive/tar"
+	files   []string // e.g., ["reader.go", "reader_test.go", ...]
+
+	module      *moduleInfo // nil for packages outside a module (e.g., "archive/tar")
+	imports     []string    // e.g., ["bytes", "errors", "fmt", "io", ...]
+	testImports []string    // e.g., ["bytes", "crypto/md5", "testing", ...]
+	err         string      // error loading the package, if any
+	depOnly     bool        // only loaded as a dependency of the requested packages
+
+	// platforms maps each file to the platforms it is built for.
+	// It is only populated when loading packages for multiple platforms.
+	platforms map[string][]string // e.g., {"file_unix.go": ["darwin/arm64", "linux/amd64"], ...}
+
+	packages map[string]*packageInfo
+}
+
+// buildContext is the build environment to load packages for.
+type buildContext struct {
+	goos   string   // e.g., "linux"; empty for the host GOOS
+	goarch string   // e.g., "amd64"; empty for the host GOARCH
+	tags   []string // e.g., ["purego", "netgo"]
+}
+
+// platform returns the GOOS/GOARCH pair (e.g., "linux/amd64").
+func (bctx buildContext) platform() string {
+	return bctx.goos + "/" + bctx.goarch
+}
+
+// parsePlatforms parses a comma separated list of GOOS/GOARCH pairs
+// (e.g., "linux/amd64,windows/amd64") as build contexts with the given tags.
+func parsePlatforms(s string, tags []string) ([]buildContext, error) {
+	var bctxs []buildContext
+	for _, platform := range strings.Split(s, ",") {
+		i := strings.IndexByte(platform, '/')
+		if i <= 0 || i == len(platform)-1 {
+			return nil, fmt.Errorf("invalid platform %q, must be of the form GOOS/GOARCH", platform)
+		}
+		bctxs = append(bctxs, buildContext{goos: platform[:i], goarch: platform[i+1:], tags: tags})
+	}
+	return bctxs, nil
+}
+
+// moduleInfo is information about the module that contains a package.
+type moduleInfo struct {
+	Path    string // e.g., "google.golang.org/protobuf"
+	Version string // e.g., "v1.26.0"; empty for the main module
+	Dir     string // e.g., "/home/user/go/pkg/mod/google.golang.org/protobuf@v1.26.0"
+	Main    bool   // whether this is the main module
+}
+
+// goListPackage is the subset of the `go list -json` output used by godoc.
+// See `go help list` for documentation on each field.
+type goListPackage struct {
+	Name         string
+	ImportPath   string
+	Dir          string
+	GoFiles      []string
+	CgoFiles     []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+	Module       *moduleInfo
+	DepOnly      bool
+	Error        *struct{ Err string }
+}
+
+// loadPackages loads all packages matching the patterns (and their dependencies)
+// for every build context and returns a single root node representing
+// the package tree. If there are multiple build contexts, each package is
+// the union of the package as loaded for every context.
+func loadPackages(patterns []string, bctxs []buildContext) (*packageInfo, error) {
+	root := new(packageInfo)
+	for _, bctx := range bctxs {
+		if err := root.loadPackages(patterns, bctx, len(bctxs) > 1); err != nil {
+			return root, err
+		}
+	}
+	return root, nil
+}
+
+// loadPackages loads all packages matching the patterns (and their dependencies)
+// for the build context and merges them into the package tree rooted at root.
+// If recordPlatforms is set, it records the platform for every file.
+func (root *packageInfo) loadPackages(patterns []string, bctx buildContext, recordPlatforms bool) error {
+	pkgs, err := goList(append([]string{"-deps"}, patterns...), bctx)
+	if err != nil {
+		return err
+	}
+
+	// We need to know the pseudo-source for builtin declarations,
+	// but it is only loaded as a dependency unless the patterns match it.
+	var hasBuiltin bool
+	for _, p := range pkgs {
+		hasBuiltin = hasBuiltin || p.ImportPath == "builtin"
+	}
+	if !hasBuiltin {
+		builtin, err := goList([]string{"builtin"}, bctx)
+		if err != nil {
+			return err
+		}
+		for _, p := range builtin {
+			p.DepOnly = true
+		}
+		pkgs = append(pkgs, builtin...)
+	}
+
+	for _, p := range pkgs {
+		root.merge(p.packageInfo(bctx, recordPlatforms))
+	}
+	return nil
+}
+
+// packageInfo converts the listed package as loaded for the build context
+// to a package node. If recordPlatforms is set, it records the platform
+// for every file.
+func (p *goListPackage) packageInfo(bctx buildContext, recordPlatforms bool) *packageInfo {
+	pkg := &packageInfo{
+		name:        p.Name,
+		impPath:     p.ImportPath,
+		dirPath:     p.Dir,
+		module:      p.Module,
+		imports:     p.Imports,
+		testImports: mergeStrings(p.TestImports, p.XTestImports),
+		depOnly:     p.DepOnly,
+	}
+	for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.TestGoFiles, p.XTestGoFiles} {
+		pkg.files = append(pkg.files, files...)
+	}
+	sort.Strings(pkg.files)
+	if p.Error != nil {
+		pkg.err = p.Error.Err
+	}
+	if recordPlatforms {
+		pkg.platforms = make(map[string][]string)
+		for _, file := range pkg.files {
+			pkg.platforms[file] = []string{bctx.platform()}
+		}
+	}
+	return pkg
+}
+
+// goList runs "go list" with the arguments for the build context
+// and returns the listed packages.
+func goList(args []string, bctx buildContext) ([]*goListPackage, error) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"list", "-e", "-json", "-tags=" + strings.Join(bctx.tags, ",")}, args...)
+	cmd := exec.Command("go", args...)
+	cmd.Env = os.Environ()
+	if bctx.goos != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+bctx.goos)
+	}
+	if bctx.goarch != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+bctx.goarch)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("execute `go list` error: %w\n%s", err, stderr.String())
+	}
+	return decodeGoList(&stdout)
+}
+
+// decodeGoList decodes the stream of packages output by "go list -json".
+func decodeGoList(r io.Reader) ([]*goListPackage, error) {
+	var pkgs []*goListPackage
+	dec := json.NewDecoder(r)
+	for {
+		p := new(goListPackage)
+		if err := dec.Decode(p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("unable to parse `go list` output: %w", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// mergeStrings returns the sorted union of a and b.
+func mergeStrings(a, b []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (root *packageInfo) merge(pkg *packageInfo) {
+	var dirName string
+	suffix := strings.TrimPrefix(strings.TrimPrefix(pkg.impPath, root.impPath), "/")
+	if i := strings.IndexByte(suffix, '/'); i >= 0 {
+		dirName, suffix = suffix[:i], suffix[i+len("/"):]
+	} else {
+		dirName, suffix = suffix, ""
+	}
+	child, ok := root.packages[dirName]
+	if !ok {
+		if root.packages == nil {
+			root.packages = make(map[string]*packageInfo)
+		}
+		child = &packageInfo{impPath: path.Join(root.impPath, dirName)}
+		root.packages[dirName] = child
+	}
+	switch {
+	case suffix == "" && child.dirPath != "":
+		child.combine(pkg)
+	case suffix == "":
+		impPath, packages := child.impPath, child.packages
+		*child = *pkg
+		child.impPath, child.packages = impPath, packages
+	default:
+		child.merge(pkg)
+	}
+}
+
+// combine merges another instance of the same package
+// (as loaded for a different build context) into pkg.
+func (pkg *packageInfo) combine(other *packageInfo) {
+	if pkg.name == "" {
+		pkg.name = other.name
+	}
+	if pkg.err == "" || other.err == "" {
+		pkg.err = ""
+	}
+	pkg.depOnly = pkg.depOnly && other.depOnly
+	pkg.files = mergeStrings(pkg.files, other.files)
+	pkg.imports = mergeStrings(pkg.imports, other.imports)
+	pkg.testImports = mergeStrings(pkg.testImports, other.testImports)
+
+	if pkg.platforms == nil {
+		pkg.platforms = make(map[string][]string)
+	}
+	for file, platforms := range other.platforms {
+		pkg.platforms[file] = append(pkg.platforms[file], platforms...)
+	}
+}
+
+// clone returns a copy of the package tree rooted at pkg.
+// The information for each package is shallow copied.
+func (pkg *packageInfo) clone() *packageInfo {
+	pkg2 := *pkg
+	pkg2.packages = nil
+	for name, child := range pkg.packages {
+		if pkg2.packages == nil {
+			pkg2.packages = make(map[string]*packageInfo)
+		}
+		pkg2.packages[name] = child.clone()
+	}
+	return &pkg2
+}
+
+// prune removes every package that drop reports true for from the tree
+// rooted at pkg, along with any directories left without packages.
+// It reports whether pkg itself is left without any packages.
+func (pkg *packageInfo) prune(drop func(*packageInfo) bool) (empty bool) {
+	for name, child := range pkg.packages {
+		if child.prune(drop) {
+			delete(pkg.packages, name)
+		}
+	}
+	if pkg.dirPath != "" && drop(pkg) {
+		*pkg = packageInfo{impPath: pkg.impPath, packages: pkg.packages}
+	}
+	return pkg.dirPath == "" && pkg.err == "" && len(pkg.packages) == 0
+}
+
+func (pkg *packageInfo) resolve(impPath string) *packageInfo {
+	for len(impPath) > 0 {
+		dirName := impPath
+		if i := strings.IndexByte(impPath, '/'); i >= 0 {
+			dirName, impPath = impPath[:i], impPath[i+len("/"):]
+		} else {
+			dirName, impPath = impPath, ""
+		}
+		pkg = pkg.packages[dirName]
+		if pkg == nil {
+			return nil
+		}
+	}
+	return pkg
+}
+
+func (pkg *packageInfo) walk(visit func(*packageInfo) bool) bool {
+	if !visit(pkg) {
+		return false
+	}
+	var names []string
+	for name := range pkg.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !pkg.packages[name].walk(visit) {
+			return false
+		}
+	}
+	return true
+}
+
+func (pkg *packageInfo) loadDoc() (*token.FileSet, *doc.Package, error) {
+	fset, files, err := pkg.parseFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	docPkg, err := pkg.newDoc(fset, files)
+	return fset, docPkg, err
+}
+
+// parseFiles parses all files in the package, including comments.
+func (pkg *packageInfo) parseFiles() (*token.FileSet, []*ast.File, error) {
+	if len(pkg.files) == 0 {
+		return nil, nil, fmt.Errorf("no files present for %q", pkg.impPath)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range pkg.files {
+		name = filepath.Join(pkg.dirPath, name)
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	return fset, files, nil
+}
+
+// newDoc computes the package documentation from the parsed files.
+// The files may be modified.
+func (pkg *packageInfo) newDoc(fset *token.FileSet, files []*ast.File) (*doc.Package, error) {
+	var noFiltering, noTypeAssociation bool
+	if pkg.impPath == "builtin" {
+		noFiltering = true
+		noTypeAssociation = true
+	}
+
+	var m doc.Mode
+	if noFiltering {
+		m |= doc.AllDecls
+	}
+	docPkg, err := doc.NewFromFiles(fset, files, pkg.impPath, m)
+	if noTypeAssociation {
+		for _, t := range docPkg.Types {
+			docPkg.Consts, t.Consts = append(docPkg.Consts, t.Consts...), nil
+			docPkg.Vars, t.Vars = append(docPkg.Vars, t.Vars...), nil
+			docPkg.Funcs, t.Funcs = append(docPkg.Funcs, t.Funcs...), nil
+		}
+		sort.Slice(docPkg.Funcs, func(i, j int) bool { return docPkg.Funcs[i].Name < docPkg.Funcs[j].Name })
+	}
+	return docPkg, err
+}
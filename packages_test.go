@@ -0,0 +1,146 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergePackages(t *testing.T) {
+	// Output of "go list -e -json -deps ./..." for two platforms.
+	outputs := []struct {
+		bctx buildContext
+		json string
+	}{{
+		bctx: buildContext{goos: "linux", goarch: "amd64"},
+		json: `{
+	"Dir": "/go/src/io",
+	"ImportPath": "io",
+	"Name": "io",
+	"GoFiles": ["io.go", "pipe.go"],
+	"Imports": ["errors", "sync"],
+	"DepOnly": true
+}
+{
+	"Dir": "/home/user/m/p",
+	"ImportPath": "example.com/m/p",
+	"Name": "p",
+	"Module": {"Path": "example.com/m", "Dir": "/home/user/m", "Main": true},
+	"GoFiles": ["p.go", "p_linux.go"],
+	"TestGoFiles": ["p_test.go"],
+	"Imports": ["io"],
+	"TestImports": ["testing"]
+}
+{
+	"Dir": "/home/user/m/p/windows",
+	"ImportPath": "example.com/m/p/windows",
+	"Module": {"Path": "example.com/m", "Dir": "/home/user/m", "Main": true},
+	"Error": {"Err": "build constraints exclude all Go files in /home/user/m/p/windows"}
+}
+`,
+	}, {
+		bctx: buildContext{goos: "windows", goarch: "amd64"},
+		json: `{
+	"Dir": "/home/user/m/p",
+	"ImportPath": "example.com/m/p",
+	"Name": "p",
+	"Module": {"Path": "example.com/m", "Dir": "/home/user/m", "Main": true},
+	"GoFiles": ["p.go", "p_windows.go"],
+	"XTestGoFiles": ["example_test.go"],
+	"Imports": ["io", "syscall"],
+	"XTestImports": ["example.com/m/p", "fmt"]
+}
+{
+	"Dir": "/home/user/m/p/windows",
+	"ImportPath": "example.com/m/p/windows",
+	"Name": "windows",
+	"Module": {"Path": "example.com/m", "Dir": "/home/user/m", "Main": true},
+	"GoFiles": ["windows.go"]
+}
+`,
+	}}
+
+	root := new(packageInfo)
+	for _, out := range outputs {
+		pkgs, err := decodeGoList(strings.NewReader(out.json))
+		if err != nil {
+			t.Fatalf("decodeGoList error: %v", err)
+		}
+		for _, p := range pkgs {
+			root.merge(p.packageInfo(out.bctx, true))
+		}
+	}
+
+	var got []string
+	root.walk(func(pkg *packageInfo) bool {
+		got = append(got, pkg.impPath)
+		return true
+	})
+	want := []string{"", "example.com", "example.com/m", "example.com/m/p", "example.com/m/p/windows", "io"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("package tree mismatch (-want +got):\n%s", diff)
+	}
+
+	module := &moduleInfo{Path: "example.com/m", Dir: "/home/user/m", Main: true}
+	tests := []struct {
+		impPath string
+		want    *packageInfo
+	}{{
+		impPath: "io",
+		want: &packageInfo{
+			name:      "io",
+			impPath:   "io",
+			dirPath:   "/go/src/io",
+			files:     []string{"io.go", "pipe.go"},
+			imports:   []string{"errors", "sync"},
+			depOnly:   true,
+			platforms: map[string][]string{"io.go": {"linux/amd64"}, "pipe.go": {"linux/amd64"}},
+		},
+	}, {
+		impPath: "example.com/m/p",
+		want: &packageInfo{
+			name:        "p",
+			impPath:     "example.com/m/p",
+			dirPath:     "/home/user/m/p",
+			files:       []string{"example_test.go", "p.go", "p_linux.go", "p_test.go", "p_windows.go"},
+			module:      module,
+			imports:     []string{"io", "syscall"},
+			testImports: []string{"example.com/m/p", "fmt", "testing"},
+			platforms: map[string][]string{
+				"example_test.go": {"windows/amd64"},
+				"p.go":            {"linux/amd64", "windows/amd64"},
+				"p_linux.go":      {"linux/amd64"},
+				"p_test.go":       {"linux/amd64"},
+				"p_windows.go":    {"windows/amd64"},
+			},
+		},
+	}, {
+		// The error for one platform is dropped since it loads for another.
+		impPath: "example.com/m/p/windows",
+		want: &packageInfo{
+			name:      "windows",
+			impPath:   "example.com/m/p/windows",
+			dirPath:   "/home/user/m/p/windows",
+			files:     []string{"windows.go"},
+			module:    module,
+			platforms: map[string][]string{"windows.go": {"windows/amd64"}},
+		},
+	}}
+	for _, tt := range tests {
+		got := root.resolve(tt.impPath)
+		if got == nil {
+			t.Errorf("resolve(%q) = nil", tt.impPath)
+			continue
+		}
+		got2 := *got
+		got2.packages = nil
+		if diff := cmp.Diff(tt.want, &got2, cmp.AllowUnexported(packageInfo{})); diff != "" {
+			t.Errorf("package %q mismatch (-want +got):\n%s", tt.impPath, diff)
+		}
+	}
+}
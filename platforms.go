@@ -0,0 +1,87 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+)
+
+// declPlatforms returns the platforms that each top-level declaration in
+// the parsed files of pkg is built for, keyed by the declaration name
+// (e.g., "Getpagesize", "File", or "File.Fd"). Declarations that are built
+// for every platform in allPlatforms are omitted.
+func (pkg *packageInfo) declPlatforms(fset *token.FileSet, files []*ast.File, allPlatforms []string) map[string][]string {
+	if len(pkg.platforms) == 0 {
+		return nil
+	}
+
+	// Collect the set of platforms for each declaration.
+	sets := make(map[string]map[string]bool)
+	addName := func(name string, platforms []string) {
+		if sets[name] == nil {
+			sets[name] = make(map[string]bool)
+		}
+		for _, p := range platforms {
+			sets[name][p] = true
+		}
+	}
+	for _, file := range files {
+		platforms := pkg.platforms[filepath.Base(fset.File(file.Pos()).Name())]
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				name := decl.Name.Name
+				if decl.Recv != nil && len(decl.Recv.List) > 0 {
+					name = recvTypeName(decl.Recv.List[0].Type) + "." + name
+				}
+				addName(name, platforms)
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						addName(spec.Name.Name, platforms)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							addName(name.Name, platforms)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Sort the platforms for each declaration
+	// in the same order as allPlatforms.
+	m := make(map[string][]string)
+	for name, set := range sets {
+		if len(set) == len(allPlatforms) {
+			continue
+		}
+		for _, p := range allPlatforms {
+			if set[p] {
+				m[name] = append(m[name], p)
+			}
+		}
+	}
+	return m
+}
+
+// recvTypeName returns the name of the receiver type (e.g., "File" for "*File").
+func recvTypeName(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		return recvTypeName(x.X)
+	case *ast.ParenExpr:
+		return recvTypeName(x.X)
+	case *ast.IndexExpr:
+		return recvTypeName(x.X)
+	case *ast.Ident:
+		return x.Name
+	default:
+		return ""
+	}
+}
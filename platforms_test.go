@@ -0,0 +1,115 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeclPlatforms(t *testing.T) {
+	srcs := []struct{ name, src string }{{
+		name: "file.go",
+		src: `package os
+
+type File struct{}
+
+func (f *File) Name() string { return "" }
+`,
+	}, {
+		name: "file_unix.go",
+		src: `//go:build linux || darwin
+
+package os
+
+const PathSeparator = '/'
+
+func (f *File) Fd() uintptr { return 0 }
+
+func Getpagesize() int { return 4096 }
+`,
+	}, {
+		name: "file_windows.go",
+		src: `//go:build windows
+
+package os
+
+const PathSeparator = '\\'
+
+func (f *File) Fd() uintptr { return 0 }
+
+var ErrWindows error
+
+type Handle uintptr
+`,
+	}}
+	allPlatforms := []string{"darwin/arm64", "linux/amd64", "windows/amd64"}
+	listed := map[string]*goListPackage{
+		"darwin/arm64":  {GoFiles: []string{"file.go", "file_unix.go"}},
+		"linux/amd64":   {GoFiles: []string{"file.go", "file_unix.go"}},
+		"windows/amd64": {GoFiles: []string{"file.go", "file_windows.go"}},
+	}
+
+	dir := t.TempDir()
+	for _, src := range srcs {
+		if err := os.WriteFile(filepath.Join(dir, src.name), []byte(src.src), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Merge the package as loaded for every platform.
+	root := new(packageInfo)
+	for _, platform := range allPlatforms {
+		bctxs, err := parsePlatforms(platform, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := listed[platform]
+		p.Name, p.ImportPath, p.Dir = "os", "os", dir
+		root.merge(p.packageInfo(bctxs[0], true))
+	}
+	pkg := root.resolve("os")
+
+	fset, files, err := pkg.parseFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pkg.declPlatforms(fset, files, allPlatforms)
+	want := map[string][]string{
+		"Getpagesize": {"darwin/arm64", "linux/amd64"},
+		"ErrWindows":  {"windows/amd64"},
+		"Handle":      {"windows/amd64"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("declPlatforms mismatch (-want +got):\n%s", diff)
+	}
+
+	// Only the declarations that are not built for every platform are labeled.
+	var buf bytes.Buffer
+	cfg := &renderConfig{root: root, platforms: allPlatforms}
+	if err := pkg.renderHTML(&buf, cfg); err != nil {
+		t.Fatalf("renderHTML error: %v", err)
+	}
+	for label, want := range map[string]int{
+		"Only available on":                            3,
+		"Only available on darwin/arm64, linux/amd64.": 1,
+		"Only available on windows/amd64.":             2,
+	} {
+		if got := strings.Count(buf.String(), label); got != want {
+			t.Errorf("page contains %q %d times, want %d", label, got, want)
+		}
+	}
+
+	// Packages loaded for a single platform are not labeled.
+	pkg.platforms = nil
+	if got := pkg.declPlatforms(fset, files, nil); got != nil {
+		t.Errorf("declPlatforms for a single platform = %v, want nil", got)
+	}
+}
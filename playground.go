@@ -0,0 +1,284 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go/format"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// buildTimeout is the maximum duration to build a program.
+	buildTimeout = time.Minute
+	// runTimeout is the maximum duration to run a program.
+	runTimeout = 10 * time.Second
+	// maxProgramOutput is the maximum number of bytes of program output.
+	maxProgramOutput = 1 << 20
+)
+
+// playgroundTokenHeader is the header that requests to the playground
+// endpoints must set to the token of the playground.
+const playgroundTokenHeader = "X-Playground-Token"
+
+// playground runs example programs locally, implementing the "/compile"
+// and "/fmt" endpoints of the Go playground (https://play.golang.org).
+//
+// Programs are built within the current directory, so that they may import
+// any package in the build list of the main module, and run in a temporary
+// directory that is removed afterwards, with a minimal environment.
+// Programs are not sandboxed in any other way: they run with the privileges
+// of the server and may access anything the user running it can.
+// Thus, the server must only listen on a loopback address and requests
+// must carry a token that is only embedded in the pages it serves.
+type playground struct {
+	token string // random token that requests must carry
+
+	mu sync.Mutex // serializes building and running programs
+}
+
+// newPlayground returns a playground with a new random token.
+func newPlayground() *playground {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // should never happen
+	}
+	return &playground{token: hex.EncodeToString(b[:])}
+}
+
+// authorize reports whether the request may use the playground,
+// writing an error response if it may not.
+func (pg *playground) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	// Reject requests for other hosts (e.g., by DNS rebinding)
+	// and requests from pages of other origins.
+	if !isLoopbackHost(r.Host) {
+		http.Error(w, "forbidden host", http.StatusForbidden)
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return false
+	}
+	// Other origins can neither read the token from served pages nor send
+	// a custom header without a CORS preflight, which is never allowed.
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(playgroundTokenHeader)), []byte(pg.token)) != 1 {
+		http.Error(w, "invalid playground token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// isLoopbackHost reports whether the host (with an optional port)
+// is "localhost" or a loopback IP address.
+func isLoopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// playgroundEvent is a write to stdout or stderr by a program.
+type playgroundEvent struct {
+	Message string
+	Kind    string // "stdout" or "stderr"
+	Delay   time.Duration
+}
+
+// compileResponse is the response of the "/compile" endpoint.
+type compileResponse struct {
+	Errors string // build errors, if any
+	Events []playgroundEvent
+	Status int // exit status of the program
+}
+
+// fmtResponse is the response of the "/fmt" endpoint.
+type fmtResponse struct {
+	Body  string
+	Error string
+}
+
+// serveCompile builds and runs the program in the "body" form value.
+func (pg *playground) serveCompile(w http.ResponseWriter, r *http.Request) {
+	if !pg.authorize(w, r) {
+		return
+	}
+	resp, err := pg.compile(r.Context(), r.FormValue("body"))
+	if err != nil {
+		log.Printf("error running program: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// serveFmt formats the program in the "body" form value.
+func (pg *playground) serveFmt(w http.ResponseWriter, r *http.Request) {
+	if !pg.authorize(w, r) {
+		return
+	}
+	var resp fmtResponse
+	b, err := format.Source([]byte(r.FormValue("body")))
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Body = string(b)
+	}
+	writeJSON(w, resp)
+}
+
+// compile builds and runs the program src.
+// Build failures and timeouts are reported in the response.
+func (pg *playground) compile(ctx context.Context, src string) (resp compileResponse, err error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	dir, err := os.MkdirTemp("", "godoc-play-")
+	if err != nil {
+		return resp, err
+	}
+	defer os.RemoveAll(dir)
+	srcPath := filepath.Join(dir, "prog.go")
+	if err := os.WriteFile(srcPath, []byte(src), 0666); err != nil {
+		return resp, err
+	}
+
+	// The program is built and run separately (rather than with "go run")
+	// so that a program that runs for too long is itself killed.
+	exePath := filepath.Join(dir, "prog")
+	if runtime.GOOS == "windows" {
+		exePath += ".exe"
+	}
+	buildCtx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+	var buildOut bytes.Buffer
+	build := exec.CommandContext(buildCtx, "go", "build", "-o", exePath, srcPath)
+	build.Stdout, build.Stderr = &buildOut, &buildOut
+	if err := build.Run(); err != nil {
+		if buildCtx.Err() != nil {
+			resp.Errors = "timeout building program"
+			return resp, nil
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			return resp, err
+		}
+		// Report positions relative to the program directory,
+		// which go build may report relative to the current directory.
+		errs := buildOut.String()
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, dir); err == nil {
+				errs = strings.ReplaceAll(errs, rel+string(filepath.Separator), "")
+			}
+		}
+		resp.Errors = strings.ReplaceAll(errs, dir+string(filepath.Separator), "")
+		return resp, nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	out := &programOutput{start: time.Now()}
+	run := exec.CommandContext(runCtx, exePath)
+	run.Dir = dir
+	run.Env = programEnv(dir)
+	run.Stdout, run.Stderr = out.writer("stdout"), out.writer("stderr")
+	err = run.Run()
+	resp.Events = out.events
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() != nil:
+		resp.Errors = "timeout running program"
+	case errors.As(err, &exitErr):
+		resp.Status = exitErr.ExitCode()
+	case err != nil:
+		return resp, err
+	}
+	return resp, nil
+}
+
+// programEnv returns the environment to run a program in the directory with.
+// None of the environment of the server (e.g., credentials) is passed on.
+func programEnv(dir string) []string {
+	env := []string{"HOME=" + dir, "TMPDIR=" + dir}
+	if runtime.GOOS == "windows" {
+		// Windows requires SYSTEMROOT for many system calls.
+		env = append(env, "SYSTEMROOT="+os.Getenv("SYSTEMROOT"), "TEMP="+dir, "TMP="+dir)
+	}
+	return env
+}
+
+// programOutput records the output of a program as playground events.
+type programOutput struct {
+	start time.Time
+
+	mu     sync.Mutex
+	events []playgroundEvent
+	size   int
+}
+
+// writer returns a writer that records writes as events of the given kind.
+func (o *programOutput) writer(kind string) eventWriter {
+	return eventWriter{o, kind}
+}
+
+// eventWriter is an io.Writer that records writes to a programOutput.
+type eventWriter struct {
+	out  *programOutput
+	kind string
+}
+
+func (w eventWriter) Write(b []byte) (int, error) {
+	o := w.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(b)
+	if o.size+len(b) > maxProgramOutput {
+		b = b[:maxProgramOutput-o.size] // silently discard excess output
+	}
+	o.size += len(b)
+	if len(b) == 0 {
+		return n, nil
+	}
+	if i := len(o.events) - 1; i >= 0 && o.events[i].Kind == w.kind {
+		o.events[i].Message += string(b)
+	} else {
+		o.events = append(o.events, playgroundEvent{string(b), w.kind, time.Since(o.start)})
+	}
+	return n, nil
+}
+
+// writeJSON writes v to w as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
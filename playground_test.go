@@ -0,0 +1,178 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestIsLoopbackHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"localhost:8080", true},
+		{"127.0.0.1", true},
+		{"127.0.0.1:8080", true},
+		{"127.1.2.3:8080", true},
+		{"::1", true},
+		{"[::1]", true},
+		{"[::1]:8080", true},
+		{"[::ffff:127.0.0.1]:8080", true},
+
+		{"", false},
+		{"example.com", false},
+		{"example.com:8080", false},
+		{"localhost.example.com:8080", false},
+		{"0.0.0.0:8080", false},
+		{"10.0.0.1:8080", false},
+		{"[::]:8080", false},
+		{"[2001:db8::1]:8080", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopbackHost(tt.host); got != tt.want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	pg := newPlayground()
+	tests := []struct {
+		name   string
+		method string
+		host   string
+		origin string
+		token  string
+		want   int // status code, or 0 if authorized
+	}{
+		{name: "Valid", host: "localhost:8080", token: pg.token},
+		{name: "ValidOrigin", host: "localhost:8080", origin: "http://localhost:8080", token: pg.token},
+		{name: "ValidIPv4", host: "127.0.0.1:8080", origin: "http://127.0.0.1:8080", token: pg.token},
+		{name: "ValidIPv6", host: "[::1]:8080", origin: "http://[::1]:8080", token: pg.token},
+
+		{name: "WrongMethod", method: http.MethodGet, host: "localhost:8080", token: pg.token, want: http.StatusMethodNotAllowed},
+		{name: "ReboundHost", host: "attacker.example.com:8080", origin: "http://attacker.example.com:8080", token: pg.token, want: http.StatusForbidden},
+		{name: "ReboundIPv6", host: "[2001:db8::1]:8080", token: pg.token, want: http.StatusForbidden},
+		{name: "ForeignOrigin", host: "localhost:8080", origin: "http://attacker.example.com", token: pg.token, want: http.StatusForbidden},
+		{name: "OtherPortOrigin", host: "localhost:8080", origin: "http://localhost:9090", token: pg.token, want: http.StatusForbidden},
+		{name: "OtherLoopbackOrigin", host: "localhost:8080", origin: "http://127.0.0.1:8080", token: pg.token, want: http.StatusForbidden},
+		{name: "NullOrigin", host: "localhost:8080", origin: "null", token: pg.token, want: http.StatusForbidden},
+		{name: "MissingToken", host: "localhost:8080", want: http.StatusForbidden},
+		{name: "WrongToken", host: "localhost:8080", token: strings.Repeat("0", len(pg.token)), want: http.StatusForbidden},
+		{name: "TokenPrefix", host: "localhost:8080", token: pg.token[:len(pg.token)-1], want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/compile", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.token != "" {
+				r.Header.Set(playgroundTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			ok := pg.authorize(w, r)
+			if ok != (tt.want == 0) {
+				t.Errorf("authorize = %v, want %v", ok, tt.want == 0)
+			}
+			if tt.want != 0 && w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgramEnv(t *testing.T) {
+	const secret = "GODOC_TEST_SECRET"
+	if err := os.Setenv(secret, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(secret)
+
+	dir := t.TempDir()
+	env := programEnv(dir)
+	got := make(map[string]bool)
+	for _, kv := range env {
+		got[kv] = true
+		if strings.HasPrefix(kv, secret+"=") {
+			t.Errorf("programEnv passes on %q from the server", kv)
+		}
+	}
+	for _, want := range []string{"HOME=" + dir, "TMPDIR=" + dir} {
+		if !got[want] {
+			t.Errorf("programEnv = %q, missing %q", env, want)
+		}
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	type write struct {
+		kind string
+		data string
+	}
+	tests := []struct {
+		name   string
+		writes []write
+		want   []playgroundEvent
+	}{{
+		name: "Merge",
+		writes: []write{
+			{"stdout", "a"},
+			{"stdout", "b"},
+			{"stderr", "c"},
+			{"stderr", ""},
+			{"stdout", "d"},
+		},
+		want: []playgroundEvent{
+			{Message: "ab", Kind: "stdout"},
+			{Message: "c", Kind: "stderr"},
+			{Message: "d", Kind: "stdout"},
+		},
+	}, {
+		name: "Cap",
+		writes: []write{
+			{"stdout", strings.Repeat("a", maxProgramOutput-2)},
+			{"stderr", "bcd"},
+			{"stdout", "e"},
+			{"stderr", "f"},
+		},
+		want: []playgroundEvent{
+			{Message: strings.Repeat("a", maxProgramOutput-2), Kind: "stdout"},
+			{Message: "bc", Kind: "stderr"},
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(programOutput)
+			for _, w := range tt.writes {
+				// Excess output is discarded without failing the program.
+				n, err := out.writer(w.kind).Write([]byte(w.data))
+				if n != len(w.data) || err != nil {
+					t.Errorf("Write(%d bytes) = (%d, %v), want (%d, nil)", len(w.data), n, err, len(w.data))
+				}
+			}
+			if diff := cmp.Diff(tt.want, out.events, cmpopts.IgnoreFields(playgroundEvent{}, "Delay")); diff != "" {
+				t.Errorf("events mismatch (-want +got):\n%s", diff)
+			}
+			if out.size > maxProgramOutput {
+				t.Errorf("recorded %d bytes of output, want at most %d", out.size, maxProgramOutput)
+			}
+		})
+	}
+}
@@ -1,101 +1,338 @@
-// Copyright 2021 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-package main
-
-import (
-	"context"
-	"go/ast"
-	"go/token"
-	"io"
-	"path"
-	"reflect"
-	"sort"
-
-	"github.com/dsnet/godoc/internal/doc"
-	"github.com/dsnet/godoc/internal/render"
-	"github.com/google/safehtml"
-	"github.com/google/safehtml/template"
-)
-
-func (pkg *packageInfo) renderHTML(w io.Writer) error {
-	var name string
-	var docPkg *doc.Package
-	exs := new(examples)
-	funcMap := map[string]interface{}{
-		"safe_id": render.SafeGoID,
-		// "safe_script": legacyconversions.RiskilyAssumeScript,
-	}
-	if len(pkg.files) > 0 {
-		var fset *token.FileSet
-		var err error
-		fset, docPkg, err = pkg.loadDoc()
-		if err != nil {
-			return err
-		}
-		exs = collectExamples(docPkg)
-
-		r := render.New(context.Background(), fset, docPkg, &render.Options{
-			PackageURL: func(path string) (url string) {
-				return "/" + path
-			},
-			DisableHotlinking: true,
-		})
-		funcMap["render_synopsis"] = r.Synopsis
-		funcMap["render_doc"] = r.DocHTML
-		funcMap["render_decl"] = r.DeclHTML
-		funcMap["render_code"] = r.CodeHTML
-		name = docPkg.Name
-	} else {
-		name = path.Base(pkg.impPath)
-		if name == "." {
-			name = "/"
-		}
-	}
-
-	var subDirs []string
-	for dir := range pkg.packages {
-		subDirs = append(subDirs, dir)
-	}
-	sort.Strings(subDirs)
-
-	return template.Must(htmlPackage.Clone()).Funcs(funcMap).Execute(w, struct {
-		*doc.Package
-		ImpPath  string
-		Name     string
-		Examples *examples
-		SubDirs  []string
-	}{docPkg, pkg.impPath, name, exs, subDirs})
-}
-
-var htmlPackage = func() *template.Template {
-	t := template.New("package").Funcs(
-		map[string]interface{}{
-			"ternary": func(q, a, b interface{}) interface{} {
-				v := reflect.ValueOf(q)
-				vz := reflect.New(v.Type()).Elem()
-				if reflect.DeepEqual(v.Interface(), vz.Interface()) {
-					return b
-				}
-				return a
-			},
-			"render_synopsis": func(ast.Decl) (_ string) { return },
-			"render_doc":      func(string) (_ safehtml.HTML) { return },
-			"render_decl":     func(string, ast.Decl) (_ [2]safehtml.HTML) { return },
-			"render_code":     func(interface{}) (_ safehtml.HTML) { return },
-			"safe_id":         func(string) (_ safehtml.Identifier) { return },
-			"safe_script":     func(string) (_ safehtml.Script) { return },
-		},
-	)
-
-	// Unfortunately, safehtml/template makes it impossible to statically parse
-	// from a non-literal, which inter-operates poorly with go:embed.
-	// Use Go reflection to call Parse and work around this safety feature.
-	parse := reflect.ValueOf(t).MethodByName("Parse")
-	in := []reflect.Value{reflect.ValueOf(indexHTML).Convert(parse.Type().In(0))}
-	out := parse.Call(in)
-	t, _ = out[0].Interface().(*template.Template)
-	err, _ := out[1].Interface().(error)
-	return template.Must(t, err)
-}()
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"io"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/doc"
+	"github.com/dsnet/godoc/internal/render"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+// renderConfig configures how packages are rendered.
+type renderConfig struct {
+	// opts is the base set of options for the render package.
+	opts render.Options
+
+	// root is the root of the package tree,
+	// used to resolve packages imported by the rendered package.
+	root *packageInfo
+
+	// platforms is the list of platforms that packages were loaded for.
+	// It is only populated when rendering for multiple platforms.
+	platforms []string
+
+	// deps reports whether to document packages that were only loaded
+	// as a dependency of the requested packages.
+	deps bool
+
+	// externalURL is the base URL for packages that are not documented
+	// (e.g., "https://pkg.go.dev/"). If empty, such packages are linked to
+	// as if they were documented.
+	externalURL string
+
+	// liveReload reports whether rendered pages should reload themselves
+	// whenever the server reloads the package tree.
+	liveReload bool
+
+	// relativeLinks reports whether links between rendered pages and to
+	// static assets are relative to the page (with explicit "index.html"
+	// suffixes), so that the output can be hosted under any path or
+	// browsed directly from the file system.
+	relativeLinks bool
+
+	// serverSearch reports whether the server provides a search page.
+	serverSearch bool
+
+	// clientSearch reports whether pages search a client-side search index
+	// emitted alongside them.
+	clientSearch bool
+
+	// playgroundToken is the token that requests to the playground endpoints
+	// must carry if the server runs examples, which are editable
+	// if the render options enable it. It is empty otherwise.
+	playgroundToken string
+
+	// orphanedExamples reports whether package pages list the examples
+	// that are not associated with any declaration.
+	orphanedExamples bool
+
+	// examples runs the examples of packages in the main modules to verify
+	// their output. It is nil if examples are not verified.
+	examples *exampleVerifier
+
+	// basePath is the URL path that all absolute links are prefixed with
+	// (e.g., "/docs/go"). It is empty if pages are served from the root.
+	basePath string
+}
+
+// documented reports whether documentation is rendered for the package pkg.
+func (cfg *renderConfig) documented(pkg *packageInfo) bool {
+	return (pkg.dirPath != "" || pkg.err != "") && (cfg.deps || !pkg.depOnly)
+}
+
+// visible reports whether a page is rendered for pkg,
+// which is the case if pkg or any package beneath it is documented.
+func (cfg *renderConfig) visible(pkg *packageInfo) bool {
+	return !pkg.walk(func(pkg *packageInfo) bool { return !cfg.documented(pkg) })
+}
+
+// packageURL returns the URL for the documentation of the package at impPath
+// as linked to from the page for the package at fromPath.
+func (cfg *renderConfig) packageURL(fromPath, impPath string) string {
+	if cfg.externalURL != "" {
+		if pkg := cfg.root.resolve(impPath); pkg == nil || !cfg.documented(pkg) {
+			return strings.TrimSuffix(cfg.externalURL, "/") + "/" + impPath
+		}
+	}
+	return cfg.pageURL(fromPath, impPath)
+}
+
+// pageURL returns the URL for the rendered page of the package at impPath
+// as linked to from the page for the package at fromPath.
+func (cfg *renderConfig) pageURL(fromPath, impPath string) string {
+	if cfg.relativeLinks {
+		return path.Join(cfg.rootURL(fromPath), impPath, "index.html")
+	}
+	return cfg.basePath + "/" + impPath
+}
+
+// assetURL returns the URL for the static asset with the given name
+// as linked to from the page for the package at fromPath.
+func (cfg *renderConfig) assetURL(fromPath, name string) string {
+	if cfg.relativeLinks {
+		return path.Join(cfg.rootURL(fromPath), name)
+	}
+	return cfg.basePath + "/" + name
+}
+
+// rootURL returns the relative URL of the root of the output
+// from the page for the package at fromPath.
+func (cfg *renderConfig) rootURL(fromPath string) string {
+	if fromPath == "" {
+		return "."
+	}
+	return strings.Repeat("../", strings.Count(fromPath, "/")) + ".."
+}
+
+// renderHTML renders the documentation for pkg as HTML to w.
+func (pkg *packageInfo) renderHTML(w io.Writer, cfg *renderConfig) error {
+	var name string
+	var docPkg *doc.Package
+	exs := new(examples)
+	var orphans []orphanedExample
+	funcMap := cfg.urlFuncs(pkg.impPath)
+	funcMap["safe_id"] = render.SafeGoID
+	// funcMap["safe_script"] = legacyconversions.RiskilyAssumeScript
+	documented := cfg.documented(pkg)
+	if documented && len(pkg.files) > 0 {
+		fset, files, err := pkg.parseFiles()
+		if err != nil {
+			return err
+		}
+		declPlatforms := pkg.declPlatforms(fset, files, cfg.platforms)
+		funcMap["platforms"] = func(name string) string {
+			return strings.Join(declPlatforms[name], ", ")
+		}
+		docPkg, err = pkg.newDoc(fset, files)
+		if err != nil {
+			return err
+		}
+		exs = collectExamples(docPkg)
+		if cfg.orphanedExamples {
+			orphans = orphanedExamples(docPkg, files)
+		}
+		run := cfg.examples.run(cfg, pkg)
+		funcMap["example_result"] = run.result
+
+		funcMap["source_url"] = func(decl ast.Decl) string {
+			pos := fset.PositionFor(decl.Pos(), false) // source pages ignore //line directives
+			return cfg.sourceURL(pkg.impPath, pkg.impPath, filepath.Base(pos.Filename)) + "#L" + strconv.Itoa(pos.Line)
+		}
+
+		r := cfg.newRenderer(pkg, fset, docPkg)
+		funcMap["render_synopsis"] = r.Synopsis
+		funcMap["render_doc"] = r.DocHTML
+		funcMap["render_decl"] = r.DeclHTML
+		funcMap["render_code"] = r.CodeHTML
+		name = docPkg.Name
+	} else {
+		name = path.Base(pkg.impPath)
+		if name == "." {
+			name = "/"
+		}
+	}
+
+	var module *moduleInfo
+	var loadErr string
+	if documented {
+		module, loadErr = pkg.module, pkg.err
+	}
+
+	type subDir struct{ Name, ImpPath string }
+	var subDirs []subDir
+	for dir, subPkg := range pkg.packages {
+		if cfg.visible(subPkg) {
+			subDirs = append(subDirs, subDir{dir, subPkg.impPath})
+		}
+	}
+	sort.Slice(subDirs, func(i, j int) bool { return subDirs[i].Name < subDirs[j].Name })
+
+	// The root page lists every documented package.
+	var index []moduleIndex
+	if pkg == cfg.root {
+		index = cfg.packageIndex()
+	}
+
+	return template.Must(htmlPackage.Clone()).Funcs(funcMap).Execute(w, struct {
+		*doc.Package
+		ImpPath    string
+		Name       string
+		Module     *moduleInfo
+		LoadError  string
+		Examples   *examples
+		Orphans    []orphanedExample
+		SubDirs    []subDir
+		Index      []moduleIndex
+		LiveReload bool
+	}{docPkg, pkg.impPath, name, module, loadErr, exs, orphans, subDirs, index, cfg.liveReload})
+}
+
+// newRenderer returns a renderer for the documentation of pkg.
+func (cfg *renderConfig) newRenderer(pkg *packageInfo, fset *token.FileSet, docPkg *doc.Package) *render.Renderer {
+	opts := cfg.opts
+	opts.PackageURL = func(impPath string) string {
+		return cfg.packageURL(pkg.impPath, impPath)
+	}
+	opts.RelatedPackages = cfg.relatedPackages(pkg)
+	return render.New(context.Background(), fset, docPkg, &opts)
+}
+
+// relatedPackages returns the documentation for all packages in the
+// package tree imported by pkg, followed by those imported by its tests.
+// Packages that fail to load are ignored.
+func (cfg *renderConfig) relatedPackages(pkg *packageInfo) []*doc.Package {
+	var related []*doc.Package
+	for _, pkg := range cfg.related(pkg) {
+		_, relPkg, err := pkg.loadDoc()
+		if err != nil {
+			continue
+		}
+		related = append(related, relPkg)
+	}
+	return related
+}
+
+// related returns all packages with source files in the package tree
+// imported by pkg, followed by those imported by its tests.
+func (cfg *renderConfig) related(pkg *packageInfo) []*packageInfo {
+	var related []*packageInfo
+	seen := make(map[string]bool)
+	for _, impPath := range append(append([]string(nil), pkg.imports...), pkg.testImports...) {
+		if seen[impPath] {
+			continue
+		}
+		seen[impPath] = true
+		pkg := cfg.root.resolve(impPath)
+		if pkg == nil || len(pkg.files) == 0 {
+			continue
+		}
+		related = append(related, pkg)
+	}
+	return related
+}
+
+// urlFuncs returns the template functions for URLs
+// as linked to from the page for the package at fromPath.
+func (cfg *renderConfig) urlFuncs(fromPath string) map[string]interface{} {
+	return map[string]interface{}{
+		"page_url": func(impPath string) string { return cfg.pageURL(fromPath, impPath) },
+		"asset_url": func(name string) safehtml.TrustedResourceURL {
+			// The URL only refers to a static asset served alongside the page.
+			return uncheckedconversions.TrustedResourceURLFromStringKnownToSatisfyTypeContract(cfg.assetURL(fromPath, name))
+		},
+		"reload_url": func() string { return cfg.basePath + "/reload" },
+		"search_url": func() string {
+			if !cfg.serverSearch {
+				return ""
+			}
+			return cfg.basePath + "/search"
+		},
+		"search_index_url": func() string {
+			if !cfg.clientSearch {
+				return ""
+			}
+			return cfg.assetURL(fromPath, searchIndexName)
+		},
+		"playground_url": func() string {
+			if cfg.playgroundToken == "" {
+				return ""
+			}
+			return cfg.basePath + "/"
+		},
+		"playground_token": func() string {
+			return cfg.playgroundToken
+		},
+	}
+}
+
+// urlFuncStubs are stubs for the functions returned by renderConfig.urlFuncs.
+var urlFuncStubs = map[string]interface{}{
+	"page_url":         func(string) (_ string) { return },
+	"asset_url":        func(string) (_ safehtml.TrustedResourceURL) { return },
+	"reload_url":       func() (_ string) { return },
+	"search_url":       func() (_ string) { return },
+	"search_index_url": func() (_ string) { return },
+	"playground_url":   func() (_ string) { return },
+	"playground_token": func() (_ string) { return },
+}
+
+var htmlPackage = parseHTML("package", indexHTML, map[string]interface{}{
+	"ternary": func(q, a, b interface{}) interface{} {
+		v := reflect.ValueOf(q)
+		vz := reflect.New(v.Type()).Elem()
+		if reflect.DeepEqual(v.Interface(), vz.Interface()) {
+			return b
+		}
+		return a
+	},
+	"render_synopsis": func(ast.Decl) (_ string) { return },
+	"render_doc":      func(string) (_ safehtml.HTML) { return },
+	"render_decl":     func(string, ast.Decl) (_ [2]safehtml.HTML) { return },
+	"render_code":     func(interface{}) (_ safehtml.HTML) { return },
+	"safe_id":         func(string) (_ safehtml.Identifier) { return },
+	"platforms":       func(string) (_ string) { return },
+	"source_url":      func(ast.Decl) (_ string) { return },
+	"example_result":  func(*example) (_ *exampleResult) { return },
+	"safe_script":     func(string) (_ safehtml.Script) { return },
+})
+
+// parseHTML parses an HTML template, where funcs (along with urlFuncStubs)
+// are stubs for the functions used by the template.
+func parseHTML(name, text string, funcs map[string]interface{}) *template.Template {
+	t := template.New(name).Funcs(urlFuncStubs).Funcs(funcs)
+
+	// Unfortunately, safehtml/template makes it impossible to statically parse
+	// from a non-literal, which inter-operates poorly with go:embed.
+	// Use Go reflection to call Parse and work around this safety feature.
+	parse := reflect.ValueOf(t).MethodByName("Parse")
+	in := []reflect.Value{reflect.ValueOf(text).Convert(parse.Type().In(0))}
+	out := parse.Call(in)
+	t, _ = out[0].Interface().(*template.Template)
+	err, _ := out[1].Interface().(error)
+	return template.Must(t, err)
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dsnet/godoc/internal/render"
+)
+
+func TestRenderRelatedPackages(t *testing.T) {
+	listed := []struct {
+		pkg  *goListPackage
+		srcs map[string]string
+	}{{
+		pkg: &goListPackage{
+			Name:         "greet",
+			ImportPath:   "example.com/greet",
+			GoFiles:      []string{"greet.go"},
+			XTestGoFiles: []string{"example_test.go"},
+			Imports:      []string{"example.com/text"},
+			XTestImports: []string{"example.com/greet", "example.com/text", "fmt"},
+		},
+		srcs: map[string]string{
+			"greet.go": `// Package greet greets.
+package greet
+
+import "example.com/text"
+
+// Greet returns a greeting for name.
+func Greet(name text.Word) string { return "Hello, " + string(name) }
+`,
+			"example_test.go": `package greet_test
+
+import (
+	"fmt"
+
+	"example.com/greet"
+	"example.com/text"
+)
+
+func ExampleGreet() {
+	fmt.Println(greet.Greet(text.Title("gopher")))
+	// Output: Hello, Gopher
+}
+`,
+		},
+	}, {
+		pkg: &goListPackage{
+			Name:       "text",
+			ImportPath: "example.com/text",
+			GoFiles:    []string{"text.go"},
+		},
+		srcs: map[string]string{
+			"text.go": `// Package text handles words.
+package text
+
+// Word is a single word.
+type Word string
+
+// Title returns s with its first letter upper-cased.
+func Title(s string) Word { return Word(s) }
+`,
+		},
+	}}
+
+	root := new(packageInfo)
+	for _, l := range listed {
+		dir := t.TempDir()
+		for name, src := range l.srcs {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+		l.pkg.Dir = dir
+		root.merge(l.pkg.packageInfo(buildContext{}, false))
+	}
+
+	// Identifiers in related packages are linked with the default options,
+	// both in declarations and in example code.
+	var buf bytes.Buffer
+	cfg := &renderConfig{root: root, opts: render.Options{DisableHotlinking: true}}
+	if err := root.resolve("example.com/greet").renderHTML(&buf, cfg); err != nil {
+		t.Fatalf("renderHTML error: %v", err)
+	}
+	for _, link := range []string{
+		`<a class="type" href="/example.com/text#Word">Word</a>`, // declaration
+		`<a href="/example.com/text#Title">Title</a>`,            // example
+	} {
+		if !strings.Contains(buf.String(), link) {
+			t.Errorf("page does not link to %q", link)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dsnet/godoc/internal/doc"
+	"github.com/google/safehtml/template"
+)
+
+// searchEntry is a documented package or declaration that can be searched for.
+type searchEntry struct {
+	Path     string `json:"p"`           // import path of the package (e.g., "encoding/json")
+	Name     string `json:"n"`           // qualified name (e.g., "json", "json.Decoder", or "json.Decoder.Decode")
+	ID       string `json:"i,omitempty"` // anchor ID within the package page; empty for packages
+	Kind     string `json:"k"`           // "package", "const", "var", "func", "type", or "method"
+	Synopsis string `json:"s,omitempty"` // first sentence of the documentation
+}
+
+// searchEntries returns an entry for every documented package in the package
+// tree and every declaration in the documentation of those packages.
+// Packages that fail to load are ignored.
+func (cfg *renderConfig) searchEntries() []searchEntry {
+	var entries []searchEntry
+	cfg.root.walk(func(pkg *packageInfo) bool {
+		if len(pkg.files) > 0 && cfg.documented(pkg) {
+			entries = append(entries, pkg.searchEntries()...)
+		}
+		return true
+	})
+	return entries
+}
+
+// searchEntries returns an entry for pkg and every declaration
+// in its documentation, or nil if it fails to load.
+func (pkg *packageInfo) searchEntries() []searchEntry {
+	_, docPkg, err := pkg.loadDoc()
+	if err != nil {
+		return nil
+	}
+	entries := []searchEntry{{pkg.impPath, docPkg.Name, "", "package", doc.Synopsis(docPkg.Doc)}}
+	add := func(kind, id, text string) {
+		entries = append(entries, searchEntry{pkg.impPath, docPkg.Name + "." + id, id, kind, doc.Synopsis(text)})
+	}
+	addValues := func(kind string, values []*doc.Value) {
+		for _, v := range values {
+			for _, name := range v.Names {
+				add(kind, name, v.Doc)
+			}
+		}
+	}
+	addValues("const", docPkg.Consts)
+	addValues("var", docPkg.Vars)
+	for _, f := range docPkg.Funcs {
+		add("func", f.Name, f.Doc)
+	}
+	for _, t := range docPkg.Types {
+		add("type", t.Name, t.Doc)
+		addValues("const", t.Consts)
+		addValues("var", t.Vars)
+		for _, f := range t.Funcs {
+			add("func", f.Name, f.Doc)
+		}
+		for _, m := range t.Methods {
+			add("method", t.Name+"."+m.Name, m.Doc)
+		}
+	}
+	return entries
+}
+
+// searcher searches the entries of the current package tree,
+// which are indexed whenever the package tree is loaded or reloaded.
+type searcher struct {
+	ready     chan struct{} // closed once the first package tree is indexed
+	readyOnce sync.Once
+
+	mu      sync.Mutex
+	entries []searchEntry
+}
+
+// newSearcher returns a searcher without any entries.
+// Searches block until the first package tree is indexed.
+func newSearcher() *searcher {
+	return &searcher{ready: make(chan struct{})}
+}
+
+// index replaces the entries with those of the package tree of cfg.
+func (s *searcher) index(cfg *renderConfig) {
+	log.Printf("indexing packages for search")
+	entries := cfg.searchEntries()
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// watch indexes the current package tree of w,
+// and indexes it again whenever it is reloaded, forever.
+func (s *searcher) watch(w *watcher) {
+	for {
+		changed := w.changes()
+		s.index(w.config())
+		<-changed
+	}
+}
+
+// maxSearchResults is the maximum number of search results.
+const maxSearchResults = 100
+
+// searchResult is a matching search entry.
+type searchResult struct {
+	searchEntry
+	URL   string
+	score int
+}
+
+// search returns the entries that best match the query, ordered by rank.
+func (s *searcher) search(cfg *renderConfig, query string) []searchResult {
+	<-s.ready
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil
+	}
+	var results []searchResult
+	for _, e := range entries {
+		if score := matchEntry(e, query); score > 0 {
+			url := cfg.pageURL("", e.Path)
+			if e.ID != "" {
+				url += "#" + e.ID
+			}
+			results = append(results, searchResult{e, url, score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		switch {
+		case ri.score != rj.score:
+			return ri.score > rj.score
+		case (ri.Kind == "package") != (rj.Kind == "package"):
+			return ri.Kind == "package"
+		case len(ri.Name) != len(rj.Name):
+			return len(ri.Name) < len(rj.Name)
+		case ri.Name != rj.Name:
+			return ri.Name < rj.Name
+		default:
+			return ri.Path < rj.Path
+		}
+	})
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results
+}
+
+// matchEntry reports how well the entry matches the query,
+// where a higher score is a better match and zero is no match.
+//
+// It must be kept in sync with matchEntry in code.js.
+//
+// Identifiers are matched case-insensitively against the qualified name
+// (and import path for packages), preferring exact matches, then prefix
+// matches, then substring matches, then fuzzy matches where the characters
+// of the query appear in order. Otherwise, an entry matches if every word
+// of the query appears in its synopsis.
+func matchEntry(e searchEntry, query string) int {
+	q := strings.ToLower(query)
+	name := strings.ToLower(e.Name)
+	ident := name[strings.LastIndexByte(name, '.')+1:]
+	var path string
+	if e.Kind == "package" {
+		path = strings.ToLower(e.Path)
+	}
+	switch {
+	case name == q || path == q:
+		return 1000
+	case ident == q:
+		return 900
+	case strings.HasPrefix(name, q) || strings.HasPrefix(ident, q) || strings.HasPrefix(path, q):
+		return 800
+	case strings.Contains(name, q) || strings.Contains(path, q):
+		return 600
+	}
+	if gaps, ok := fuzzyMatch(name, q); ok {
+		return 400 - minInt(gaps, 300)
+	}
+	if words := strings.FieldsFunc(q, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }); len(words) > 0 {
+		synopsis := strings.ToLower(e.Synopsis)
+		for _, word := range words {
+			if !strings.Contains(synopsis, word) {
+				return 0
+			}
+		}
+		return 50
+	}
+	return 0
+}
+
+// fuzzyMatch reports whether every character of the query appears in s
+// in the same order, and the number of characters skipped between them.
+// Characters are counted as runes, which the client-side search
+// counts as code points in the same way.
+func fuzzyMatch(s, query string) (gaps int, ok bool) {
+	i := 0
+	for _, r := range query {
+		j := strings.IndexRune(s[i:], r)
+		if j < 0 {
+			return 0, false
+		}
+		if i > 0 {
+			gaps += utf8.RuneCountInString(s[i : i+j])
+		}
+		_, n := utf8.DecodeRuneInString(s[i+j:])
+		i += j + n
+	}
+	return gaps, true
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// searchIndexName is the name of the client-side search index
+// in the generated output.
+const searchIndexName = "search-index.js"
+
+// searchIndexPrefix and searchIndexSuffix surround the JSON array of entries
+// in the client-side search index, which is a script that assigns them to
+// a global variable, since browsers load scripts from file:// URLs
+// but refuse to fetch other files from them.
+const (
+	searchIndexPrefix = "var godocSearchIndex = "
+	searchIndexSuffix = ";\n"
+)
+
+// searchIndexEntry is an entry in the client-side search index.
+type searchIndexEntry struct {
+	searchEntry
+	URL string `json:"u"` // relative to the index
+}
+
+// searchIndex returns the client-side search index for the entries.
+func (cfg *renderConfig) searchIndex(entries []searchEntry) []byte {
+	var index []searchIndexEntry
+	for _, e := range entries {
+		url := e.Path
+		if cfg.relativeLinks {
+			url = cfg.pageURL("", e.Path)
+		}
+		if e.ID != "" {
+			url += "#" + e.ID
+		}
+		index = append(index, searchIndexEntry{e, url})
+	}
+	// The JSON encoding escapes the characters that are not valid
+	// within a JavaScript string literal (i.e., U+2028 and U+2029),
+	// so the array is also valid JavaScript.
+	b, err := json.Marshal(index)
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return []byte(searchIndexPrefix + string(b) + searchIndexSuffix)
+}
+
+// parseSearchIndex parses the entries of a client-side search index.
+func parseSearchIndex(b []byte) ([]searchIndexEntry, error) {
+	s := string(b)
+	if !strings.HasPrefix(s, searchIndexPrefix) || !strings.HasSuffix(s, searchIndexSuffix) {
+		return nil, fmt.Errorf("malformed search index")
+	}
+	var index []searchIndexEntry
+	err := json.Unmarshal([]byte(s[len(searchIndexPrefix):len(s)-len(searchIndexSuffix)]), &index)
+	return index, err
+}
+
+// renderSearchHTML renders the search results for the query as HTML to w.
+func (cfg *renderConfig) renderSearchHTML(w io.Writer, query string, results []searchResult) error {
+	return template.Must(htmlSearch.Clone()).Funcs(cfg.urlFuncs("")).Execute(w, struct {
+		Query      string
+		Results    []searchResult
+		LiveReload bool
+	}{query, results, cfg.liveReload})
+}
+
+var htmlSearch = parseHTML("search", searchHTML, nil)
@@ -0,0 +1,169 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchEntry(t *testing.T) {
+	pkg := searchEntry{Path: "encoding/json", Name: "json", Kind: "package", Synopsis: "Package json implements encoding and decoding of JSON."}
+	typ := searchEntry{Path: "encoding/json", Name: "json.Decoder", ID: "Decoder", Kind: "type", Synopsis: "A Decoder reads and decodes JSON values from an input stream."}
+	method := searchEntry{Path: "encoding/json", Name: "json.Decoder.Decode", ID: "Decoder.Decode", Kind: "method"}
+	unicode := searchEntry{Path: "example.com/größe", Name: "größe.ÜberGröße", ID: "ÜberGröße", Kind: "func"}
+
+	tests := []struct {
+		entry searchEntry
+		query string
+		want  int
+	}{
+		// Exact matches of the qualified name or import path.
+		{pkg, "json", 1000},
+		{pkg, "JSON", 1000},
+		{pkg, "encoding/json", 1000},
+		{typ, "json.decoder", 1000},
+		{typ, "encoding/json", 0}, // only packages match the import path
+
+		// Exact matches of the identifier.
+		{typ, "Decoder", 900},
+		{method, "decode", 900},
+
+		// Prefix matches.
+		{pkg, "js", 800},
+		{pkg, "encoding/", 800},
+		{typ, "json.dec", 800},
+		{typ, "dec", 800},
+
+		// Substring matches.
+		{pkg, "coding/js", 600},
+		{typ, "on.deco", 600},
+		{method, "coder.dec", 600},
+
+		// Fuzzy matches, penalized by the characters skipped between
+		// the characters of the query.
+		{typ, "jdc", 400 - 5},
+		{typ, "jsndcdr", 400 - 5},
+		{method, "jdd", 400 - 7},
+		{unicode, "üße", 400 - 6}, // gaps are counted in runes, not bytes
+		{unicode, "gü", 400 - 5},  // ditto
+
+		// Synopsis matches of every word of the query.
+		{pkg, "decoding JSON", 50},
+		{typ, "input, stream!", 50},
+		{typ, "output stream", 0},
+
+		// No matches.
+		{pkg, "xml", 0},
+		{pkg, "!?", 0},
+	}
+	for _, tt := range tests {
+		if got := matchEntry(tt.entry, tt.query); got != tt.want {
+			t.Errorf("matchEntry(%q, %q) = %d, want %d", tt.entry.Name, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s, query string
+		gaps     int
+		ok       bool
+	}{
+		{"", "", 0, true},
+		{"abc", "", 0, true},
+		{"abc", "abc", 0, true},
+		{"xxabc", "abc", 0, true}, // characters before the first match are not gaps
+		{"axbxxc", "abc", 3, true},
+		{"abc", "acb", 0, false},
+		{"abc", "abcd", 0, false},
+		{"äöü", "äü", 1, true},
+		{"日本語のテキスト", "日テ", 3, true},
+		{"a😀b", "ab", 1, true},
+	}
+	for _, tt := range tests {
+		gaps, ok := fuzzyMatch(tt.s, tt.query)
+		if gaps != tt.gaps || ok != tt.ok {
+			t.Errorf("fuzzyMatch(%q, %q) = (%d, %v), want (%d, %v)", tt.s, tt.query, gaps, ok, tt.gaps, tt.ok)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newSearcher()
+	s.entries = []searchEntry{
+		{Path: "encoding/json", Name: "json.Decoder", ID: "Decoder", Kind: "type"},
+		{Path: "encoding/json", Name: "json.Decoder.Decode", ID: "Decoder.Decode", Kind: "method"},
+		{Path: "encoding/json", Name: "json", Kind: "package"},
+		{Path: "encoding/xml", Name: "xml.Decoder", ID: "Decoder", Kind: "type"},
+		{Path: "encoding/xml", Name: "xml", Kind: "package", Synopsis: "Package xml implements a simple XML 1.0 parser."},
+		{Path: "example.com/decoder", Name: "decoder", Kind: "package"},
+	}
+	close(s.ready)
+
+	cfg := &renderConfig{basePath: "/docs"}
+	var got []string
+	for _, r := range s.search(cfg, " decoder ") {
+		got = append(got, r.URL)
+	}
+	want := []string{
+		"/docs/example.com/decoder",          // exact match of a package
+		"/docs/encoding/xml#Decoder",         // identifier match with a shorter name
+		"/docs/encoding/json#Decoder",        // identifier match
+		"/docs/encoding/json#Decoder.Decode", // substring match
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("search results mismatch (-want +got):\n%s", diff)
+	}
+	if got := s.search(cfg, "  "); got != nil {
+		t.Errorf("search for an empty query = %v, want nil", got)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	entries := []searchEntry{
+		{Path: "encoding/json", Name: "json", Kind: "package", Synopsis: "Package json implements encoding and decoding of JSON."},
+		{Path: "encoding/json", Name: "json.Decoder", ID: "Decoder", Kind: "type", Synopsis: "Line\u2028separator </script>"},
+	}
+	tests := []struct {
+		cfg  renderConfig
+		want []string
+	}{
+		{renderConfig{}, []string{"encoding/json", "encoding/json#Decoder"}},
+		{renderConfig{basePath: "/docs"}, []string{"encoding/json", "encoding/json#Decoder"}},
+		{renderConfig{relativeLinks: true}, []string{"encoding/json/index.html", "encoding/json/index.html#Decoder"}},
+	}
+	for i, tt := range tests {
+		b := tt.cfg.searchIndex(entries)
+		if s := string(b); strings.Contains(s, "\u2028") || strings.Contains(s, "</script>") {
+			t.Errorf("test %d, search index contains characters that are not valid in a script: %s", i, s)
+		}
+		index, err := parseSearchIndex(b)
+		if err != nil {
+			t.Errorf("test %d, parseSearchIndex error: %v", i, err)
+			continue
+		}
+		var gotEntries []searchEntry
+		var gotURLs []string
+		for _, e := range index {
+			gotEntries = append(gotEntries, e.searchEntry)
+			gotURLs = append(gotURLs, e.URL)
+		}
+		if diff := cmp.Diff(entries, gotEntries); diff != "" {
+			t.Errorf("test %d, search index entries mismatch (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(tt.want, gotURLs); diff != "" {
+			t.Errorf("test %d, search index URLs mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	for _, s := range []string{"", "[]", "godocSearchIndex([]);\n", "var godocSearchIndex = [;\n"} {
+		if _, err := parseSearchIndex([]byte(s)); err == nil {
+			t.Errorf("parseSearchIndex(%q) succeeded, want error", s)
+		}
+	}
+}
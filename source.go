@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/render"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+)
+
+// sourceURL returns the URL for the rendered source of the named file
+// in the package at impPath as linked to from the page for the package
+// at fromPath.
+func (cfg *renderConfig) sourceURL(fromPath, impPath, name string) string {
+	if cfg.relativeLinks {
+		return path.Join(cfg.rootURL(fromPath), impPath, name+".html")
+	}
+	return cfg.basePath + "/" + path.Join(impPath, name+".html")
+}
+
+// sourceFile returns the package and file name for a rendered source file
+// at the URL path relative to the root (e.g., "archive/tar/reader.go.html").
+// It reports false if there is no such documented file.
+func (cfg *renderConfig) sourceFile(urlPath string) (*packageInfo, string, bool) {
+	if !strings.HasSuffix(urlPath, ".go.html") {
+		return nil, "", false
+	}
+	dir, name := path.Split(strings.TrimSuffix(urlPath, ".html"))
+	pkg := cfg.root.resolve(strings.TrimSuffix(dir, "/"))
+	if pkg == nil || !cfg.documented(pkg) {
+		return nil, "", false
+	}
+	if i := sort.SearchStrings(pkg.files, name); i == len(pkg.files) || pkg.files[i] != name {
+		return nil, "", false
+	}
+	return pkg, name, true
+}
+
+// renderSourceHTML renders the named source file in pkg as HTML to w,
+// where every line has an anchor (e.g., "#L123").
+func (pkg *packageInfo) renderSourceHTML(w io.Writer, cfg *renderConfig, name string) error {
+	src, err := os.ReadFile(filepath.Join(pkg.dirPath, name))
+	if err != nil {
+		return err
+	}
+	type sourceLine struct {
+		Number int
+		Spans  []render.SourceSpan
+	}
+	var lines []sourceLine
+	for i, spans := range render.HighlightSource(src) {
+		lines = append(lines, sourceLine{i + 1, spans})
+	}
+
+	funcMap := cfg.urlFuncs(pkg.impPath)
+	funcMap["line_id"] = lineID
+	return template.Must(htmlSource.Clone()).Funcs(funcMap).Execute(w, struct {
+		ImpPath    string
+		Name       string
+		Lines      []sourceLine
+		LiveReload bool
+	}{pkg.impPath, name, lines, cfg.liveReload})
+}
+
+// lineID returns the anchor ID for a line number (e.g., "L123").
+func lineID(n int) safehtml.Identifier {
+	return render.SafeGoID("L" + strconv.Itoa(n))
+}
+
+var htmlSource = parseHTML("source", sourceHTML, map[string]interface{}{
+	"line_id": func(int) (_ safehtml.Identifier) { return },
+})
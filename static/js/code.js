@@ -38,4 +38,243 @@ for (i = 0; i < document.links.length; i++) {
 			}
 		}(href);
 	}
-}
\ No newline at end of file
+}
+
+// In serve mode, reload the page whenever the server reloads the packages.
+if (document.body.dataset.liveReload) {
+	events = new EventSource(document.body.dataset.liveReload);
+	events.addEventListener("reload", function () {
+		window.location.reload();
+	});
+}
+
+// In generated output, search the client-side search index,
+// which is only loaded once the search box is first used.
+if (document.body.dataset.searchIndex) {
+	searchForm = document.createElement("form");
+	searchForm.className = "search";
+	searchInput = document.createElement("input");
+	searchInput.type = "search";
+	searchInput.placeholder = "Search";
+	searchList = document.createElement("ul");
+	searchList.className = "search-dropdown";
+	searchForm.appendChild(searchInput);
+	searchForm.appendChild(searchList);
+	document.querySelector("nav.navbar div.container").appendChild(searchForm);
+
+	searchIndex = null;
+	searchIndexURL = null;
+	searchIndexError = null;
+	searchInput.onfocus = function () {
+		if (searchIndexURL == null) {
+			searchIndexURL = new URL(document.body.dataset.searchIndex, document.baseURI).href;
+			// The index is a script that assigns the entries to a global variable,
+			// which unlike other files can be loaded from file:// URLs.
+			var script = document.createElement("script");
+			script.src = searchIndexURL;
+			script.onload = function () {
+				searchIndex = window.godocSearchIndex;
+				updateSearch();
+			};
+			script.onerror = function () {
+				searchIndexError = "Unable to load the search index.";
+				updateSearch();
+			};
+			document.head.appendChild(script);
+		}
+	}
+	searchInput.oninput = updateSearch;
+	searchForm.onsubmit = function () {
+		var first = searchList.querySelector("a");
+		if (first) {
+			window.location.href = first.href;
+		}
+		return false;
+	}
+}
+
+// updateSearch lists the entries that best match the search query.
+function updateSearch() {
+	searchList.textContent = "";
+	if (searchIndexError != null) {
+		var item = document.createElement("li");
+		item.textContent = searchIndexError;
+		searchList.appendChild(item);
+		return;
+	}
+	var query = searchInput.value.trim().toLowerCase();
+	if (searchIndex == null || query == "") {
+		return;
+	}
+	var results = [];
+	for (var i = 0; i < searchIndex.length; i++) {
+		var score = matchEntry(searchIndex[i], query);
+		if (score > 0) {
+			results.push({entry: searchIndex[i], score: score});
+		}
+	}
+	// The order is the same as search results in serve mode.
+	results.sort(function (a, b) {
+		var ea = a.entry, eb = b.entry;
+		if (a.score != b.score) return b.score - a.score;
+		if ((ea.k == "package") != (eb.k == "package")) return ea.k == "package" ? -1 : 1;
+		if (ea.n.length != eb.n.length) return ea.n.length - eb.n.length;
+		if (ea.n != eb.n) return ea.n < eb.n ? -1 : 1;
+		return ea.p < eb.p ? -1 : ea.p > eb.p ? 1 : 0;
+	});
+	for (var i = 0; i < results.length && i < 20; i++) {
+		var e = results[i].entry;
+		var link = document.createElement("a");
+		link.href = new URL(e.u, searchIndexURL).href;
+		link.textContent = e.k == "package" ? e.p : e.n;
+		var kind = document.createElement("span");
+		kind.className = "search-kind";
+		kind.textContent = " " + e.k + (e.k == "package" ? "" : " in " + e.p);
+		var item = document.createElement("li");
+		item.appendChild(link);
+		item.appendChild(kind);
+		searchList.appendChild(item);
+	}
+}
+
+// matchEntry reports how well the entry matches the lower-case query,
+// where a higher score is a better match and zero is no match.
+// It must be kept in sync with matchEntry in search.go.
+function matchEntry(e, q) {
+	var name = e.n.toLowerCase();
+	var ident = name.slice(name.lastIndexOf(".") + 1);
+	var path = e.k == "package" ? e.p.toLowerCase() : "";
+	if (name == q || path == q) return 1000;
+	if (ident == q) return 900;
+	if (name.startsWith(q) || ident.startsWith(q) || (path != "" && path.startsWith(q))) return 800;
+	if (name.includes(q) || path.includes(q)) return 600;
+
+	// Match the characters of the query in order,
+	// counting the gaps between them in code points as in search.go.
+	var chars = Array.from(name), j = 0, gaps = 0;
+	for (var c of q) {
+		var k = chars.indexOf(c, j);
+		if (k < 0) {
+			gaps = -1;
+			break;
+		}
+		if (j > 0) gaps += k - j;
+		j = k + 1;
+	}
+	if (gaps >= 0) return 400 - Math.min(gaps, 300);
+
+	// Match every word of the query in the synopsis,
+	// where words consist of letters and decimal digits as in search.go.
+	var words = q.split(/[^\p{L}\p{Nd}]+/u).filter(function (w) { return w != ""; });
+	var synopsis = (e.s || "").toLowerCase();
+	if (words.length == 0) return 0;
+	for (var w of words) {
+		if (!synopsis.includes(w)) return 0;
+	}
+	return 50;
+}
+
+// In playground mode, playable examples can be run, formatted, and reset,
+// where the output of running an example is checked against its expected output.
+if (document.body.dataset.playground) {
+	var playable = document.querySelectorAll("div.example[data-playable]");
+	for (var i = 0; i < playable.length; i++) {
+		setupPlayground(playable[i]);
+	}
+}
+
+// setupPlayground adds the buttons for running, formatting, and resetting
+// the code of the example element.
+function setupPlayground(example) {
+	var code = example.querySelector("textarea.Documentation-exampleCode");
+	if (!code) {
+		return;
+	}
+	var original = code.value;
+	var expected = example.querySelector("pre.example-output");
+	code.rows = original.split("\n").length;
+
+	var buttons = document.createElement("div");
+	buttons.className = "example-buttons";
+	var result = document.createElement("pre");
+	result.className = "example-result";
+	result.hidden = true;
+	code.after(buttons, result);
+
+	function addButton(name, onclick) {
+		var button = document.createElement("button");
+		button.textContent = name;
+		button.onclick = onclick;
+		buttons.appendChild(button);
+	}
+	function showResult(text, status) {
+		result.textContent = text;
+		result.className = "example-result" + (status ? " example-" + status : "");
+		result.hidden = false;
+	}
+	function post(endpoint, callback) {
+		var body = new URLSearchParams({body: code.value, version: "2"});
+		var headers = {"X-Playground-Token": document.body.dataset.playgroundToken};
+		fetch(document.body.dataset.playground + endpoint, {method: "POST", headers: headers, body: body})
+			.then(function (resp) {
+				if (!resp.ok) {
+					return resp.text().then(function (text) { throw new Error(text); });
+				}
+				return resp.json();
+			})
+			.then(callback)
+			.catch(function (err) { showResult("Error communicating with the server: " + err.message, "fail"); });
+	}
+
+	addButton("Run", function () {
+		showResult("Waiting for remote server...");
+		post("compile", function (resp) {
+			if (resp.Errors) {
+				showResult(resp.Errors, "fail");
+				return;
+			}
+			var output = "";
+			for (var i = 0; i < (resp.Events || []).length; i++) {
+				output += resp.Events[i].Message;
+			}
+			var text = output;
+			if (resp.Status) {
+				text += "\nProgram exited: status " + resp.Status + ".";
+			}
+			if (!expected) {
+				showResult(text, resp.Status ? "fail" : "");
+			} else if (!resp.Status && outputMatches(output, expected.textContent, example.dataset.unordered)) {
+				showResult(text + "\nOutput matches the expected output.", "pass");
+			} else {
+				showResult(text + "\nOutput does not match the expected output.", "fail");
+			}
+		});
+	});
+	addButton("Format", function () {
+		post("fmt", function (resp) {
+			if (resp.Error) {
+				showResult(resp.Error, "fail");
+				return;
+			}
+			code.value = resp.Body;
+			result.hidden = true;
+		});
+	});
+	addButton("Reset", function () {
+		code.value = original;
+		result.hidden = true;
+	});
+}
+
+// outputMatches reports whether the output of an example matches
+// the expected output in the same way as "go test",
+// where unordered output may match in any order of lines.
+function outputMatches(got, want, unordered) {
+	got = got.trim();
+	want = want.trim();
+	if (unordered) {
+		got = got.split("\n").sort().join("\n");
+		want = want.split("\n").sort().join("\n");
+	}
+	return got == want;
+}
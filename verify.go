@@ -0,0 +1,191 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dsnet/godoc/internal/doc"
+)
+
+// verifyDocLinks prints a diagnostic for every delimited doc link
+// in the documentation of all packages in the package tree
+// that cannot be resolved. It reports the number of such doc links.
+func verifyDocLinks(cfg *renderConfig) (numUnresolved int) {
+	wd, _ := os.Getwd()
+	cfg.root.walk(func(pkg *packageInfo) bool {
+		if len(pkg.files) == 0 || !cfg.documented(pkg) {
+			return true
+		}
+		fset, files, err := pkg.parseFiles()
+		if err != nil {
+			log.Printf("unable to parse %q: %v", pkg.impPath, err)
+			return true
+		}
+		// Computing the documentation removes doc comments from the AST.
+		docs := docComments(files)
+		docPkg, err := pkg.newDoc(fset, files)
+		if err != nil {
+			log.Printf("unable to load documentation for %q: %v", pkg.impPath, err)
+			return true
+		}
+		r := cfg.newRenderer(pkg, fset, docPkg)
+
+		// Only verify doc comments that are part of the rendered documentation.
+		for _, cg := range nodeComments(docs, docNodes(fset, docPkg, files)) {
+			name := fset.File(cg.Pos()).Name()
+			if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+			text, lines := commentLines(fset, cg)
+			for _, link := range r.DocLinks(text) {
+				if !link.Resolved {
+					fmt.Printf("%v:%d: unresolved doc link to %v\n", name, lines[link.Line], link.Ref)
+					numUnresolved++
+				}
+			}
+		}
+		return true
+	})
+	return numUnresolved
+}
+
+// docComments returns the doc comments in the files, keyed by the node
+// that they document: the file (for the package doc comment),
+// a function declaration, a spec, or a struct field or interface method.
+// The doc comments of a spec include the doc comment of its enclosing
+// declaration.
+func docComments(files []*ast.File) map[ast.Node][]*ast.CommentGroup {
+	docs := make(map[ast.Node][]*ast.CommentGroup)
+	add := func(node ast.Node, cg *ast.CommentGroup) {
+		if cg != nil {
+			docs[node] = append(docs[node], cg)
+		}
+	}
+	for _, file := range files {
+		add(file, file.Doc)
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				add(decl, decl.Doc)
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					add(spec, decl.Doc)
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						add(spec, spec.Doc)
+					case *ast.TypeSpec:
+						add(spec, spec.Doc)
+						ast.Inspect(spec.Type, func(n ast.Node) bool {
+							if f, ok := n.(*ast.Field); ok {
+								add(f, f.Doc)
+							}
+							return true
+						})
+					}
+				}
+			}
+		}
+	}
+	return docs
+}
+
+// docNodes returns the nodes whose doc comments are part of the package
+// documentation: the non-test files, which contribute to the package
+// doc comment, and the function declarations, specs, struct fields,
+// and interface methods of every declaration in the package documentation.
+// Since docPkg is computed from the files, which filters out unexported
+// specs, fields, and methods, only the exported ones are returned.
+func docNodes(fset *token.FileSet, docPkg *doc.Package, files []*ast.File) []ast.Node {
+	var nodes []ast.Node
+	for _, file := range files {
+		if !strings.HasSuffix(fset.File(file.Pos()).Name(), "_test.go") {
+			nodes = append(nodes, file)
+		}
+	}
+	addDecl := func(decl ast.Decl) {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			nodes = append(nodes, decl)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				nodes = append(nodes, spec)
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					ast.Inspect(spec.Type, func(n ast.Node) bool {
+						if f, ok := n.(*ast.Field); ok {
+							nodes = append(nodes, f)
+						}
+						return true
+					})
+				}
+			}
+		}
+	}
+	addValues := func(vals []*doc.Value) {
+		for _, v := range vals {
+			addDecl(v.Decl)
+		}
+	}
+	addFuncs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			addDecl(f.Decl)
+		}
+	}
+	addValues(docPkg.Consts)
+	addValues(docPkg.Vars)
+	addFuncs(docPkg.Funcs)
+	for _, t := range docPkg.Types {
+		addDecl(t.Decl)
+		addValues(t.Consts)
+		addValues(t.Vars)
+		addFuncs(t.Funcs)
+		addFuncs(t.Methods)
+	}
+	return nodes
+}
+
+// nodeComments returns the doc comments of the nodes in source order,
+// where docs are the doc comments returned by docComments.
+func nodeComments(docs map[ast.Node][]*ast.CommentGroup, nodes []ast.Node) []*ast.CommentGroup {
+	var groups []*ast.CommentGroup
+	seen := make(map[*ast.CommentGroup]bool)
+	for _, node := range nodes {
+		for _, cg := range docs[node] {
+			if !seen[cg] {
+				groups = append(groups, cg)
+				seen[cg] = true
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Pos() < groups[j].Pos() })
+	return groups
+}
+
+// commentLines returns the text of the comment group with comment markers
+// removed, and the source line number of each line in the text.
+func commentLines(fset *token.FileSet, cg *ast.CommentGroup) (text string, lines []int) {
+	var texts []string
+	for _, c := range cg.List {
+		line := fset.Position(c.Slash).Line
+		if strings.HasPrefix(c.Text, "//") {
+			texts = append(texts, strings.TrimPrefix(c.Text[len("//"):], " "))
+			lines = append(lines, line)
+			continue
+		}
+		body := strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+		for i, s := range strings.Split(body, "\n") {
+			texts = append(texts, strings.TrimRight(s, " \t"))
+			lines = append(lines, line+i)
+		}
+	}
+	return strings.Join(texts, "\n"), lines
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDocNodes(t *testing.T) {
+	const src = `// Package p is documented.
+package p
+
+// Exported is documented.
+type Exported struct {
+	// Field is documented.
+	Field int
+	// unexported is not documented.
+	unexported int
+	// Nested is documented.
+	Nested struct {
+		// Inner is documented.
+		Inner int
+		// inner is not documented.
+		inner int
+	}
+}
+
+// Iface is documented.
+type Iface interface {
+	// Method is documented.
+	Method()
+	// method is not documented.
+	method()
+}
+
+// Method is documented.
+func (Exported) Method() {}
+
+// method is not documented.
+func (Exported) method() {}
+
+// unexportedType is not documented.
+type unexportedType struct {
+	// Field is not documented.
+	Field int
+}
+
+// Consts are documented.
+const (
+	// A is documented.
+	A = 1
+	// b is not documented.
+	b = 2
+)
+
+// Func is documented.
+func Func() {
+	// A body comment is not documented.
+}
+`
+	const testSrc = `// Package p_test is not documented.
+package p_test
+`
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, f := range []struct{ name, src string }{{"p.go", src}, {"p_test.go", testSrc}} {
+		file, err := parser.ParseFile(fset, f.name, f.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	docs := docComments(files)
+	pkg := &packageInfo{impPath: "example.com/p"}
+	docPkg, err := pkg.newDoc(fset, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, cg := range nodeComments(docs, docNodes(fset, docPkg, files)) {
+		got = append(got, strings.TrimSpace(cg.Text()))
+	}
+	want := []string{
+		"Package p is documented.",
+		"Exported is documented.",
+		"Field is documented.",
+		"Nested is documented.",
+		"Inner is documented.",
+		"Iface is documented.",
+		"Method is documented.",
+		"Method is documented.",
+		"Consts are documented.",
+		"A is documented.",
+		"Func is documented.",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("doc comments mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// exampleVerifier runs the examples of packages in the main modules
+// with "go test" to verify that their output matches the expected output.
+// The results for each package are cached until its source files change.
+type exampleVerifier struct {
+	tags []string // build tags to run the tests with
+
+	mu   sync.Mutex
+	runs map[string]*exampleRun // keyed by import path
+}
+
+// exampleRun is a run of the examples of a package.
+type exampleRun struct {
+	once    sync.Once
+	stamp   string                   // modification times and sizes of the inputs
+	err     string                   // error running the examples, if any (e.g., a build failure)
+	results map[string]exampleResult // keyed by function name (e.g., "ExampleFoo_bar")
+}
+
+// exampleResult is the result of running an example.
+type exampleResult struct {
+	Passed bool
+	Output string // output of go test for a failed example (e.g., "got:\n...\nwant:\n...")
+}
+
+// run returns the run of the examples of pkg, running them
+// if they have not been run since the source files were modified.
+// It returns nil if the examples of pkg are not verified.
+func (v *exampleVerifier) run(cfg *renderConfig, pkg *packageInfo) *exampleRun {
+	if v == nil || !cfg.documented(pkg) || pkg.module == nil || !pkg.module.Main || !hasTestFiles(pkg) {
+		return nil
+	}
+	stamp := cfg.stampInputs(pkg)
+	v.mu.Lock()
+	run := v.runs[pkg.impPath]
+	if run == nil || run.stamp != stamp {
+		if v.runs == nil {
+			v.runs = make(map[string]*exampleRun)
+		}
+		run = &exampleRun{stamp: stamp}
+		v.runs[pkg.impPath] = run
+	}
+	v.mu.Unlock()
+	run.once.Do(func() {
+		log.Printf("verifying examples of %q", pkg.impPath)
+		run.results, run.err = v.goTest(pkg.impPath)
+	})
+	return run
+}
+
+// hasTestFiles reports whether pkg has any test files.
+func hasTestFiles(pkg *packageInfo) bool {
+	for _, name := range pkg.files {
+		if strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// goTest runs the examples of the package at impPath with "go test".
+// Only examples with an output comment are run by go test.
+//
+// Vet is disabled since it fails the build of the entire package for
+// problems unrelated to whether examples pass (e.g., a malformed example
+// name, which the -lint mode reports instead).
+func (v *exampleVerifier) goTest(impPath string) (results map[string]exampleResult, errOutput string) {
+	args := []string{"test", "-json", "-vet=off", "-run=^Example"}
+	if len(v.tags) > 0 {
+		args = append(args, "-tags="+strings.Join(v.tags, ","))
+	}
+	args = append(args, impPath)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	results, pkgOutput := parseTestEvents(&stdout)
+	if err != nil && len(results) == 0 {
+		return nil, strings.TrimSpace(stderr.String() + pkgOutput)
+	}
+	return results, ""
+}
+
+// parseTestEvents parses the output of "go test -json" (see "go doc test2json")
+// into the result of each test that was run and the output of the package
+// that is not part of any test (e.g., build errors).
+func parseTestEvents(r io.Reader) (results map[string]exampleResult, pkgOutput string) {
+	results = make(map[string]exampleResult)
+	outputs := make(map[string]string)
+	d := json.NewDecoder(r)
+	for {
+		var event struct{ Action, Test, Output string }
+		if err := d.Decode(&event); err != nil {
+			break
+		}
+		switch {
+		case event.Action == "output" && event.Test == "", event.Action == "build-output":
+			pkgOutput += event.Output
+		case event.Test == "":
+			// Ignore the result of the package as a whole.
+		case event.Action == "output":
+			if !strings.HasPrefix(event.Output, "=== ") && !strings.HasPrefix(event.Output, "--- ") {
+				outputs[event.Test] += event.Output
+			}
+		case event.Action == "pass":
+			results[event.Test] = exampleResult{Passed: true}
+		case event.Action == "fail":
+			results[event.Test] = exampleResult{Output: strings.TrimRight(outputs[event.Test], "\n")}
+		}
+	}
+	return results, pkgOutput
+}
+
+// result returns the result of running the example ex in the run,
+// or nil if the example is not run (e.g., if it has no output comment).
+func (run *exampleRun) result(ex *example) *exampleResult {
+	if run == nil || (ex.Output == "" && !ex.EmptyOutput) {
+		return nil
+	}
+	if run.err != "" {
+		return &exampleResult{Output: run.err}
+	}
+	if r, ok := run.results["Example"+ex.Name]; ok {
+		return &r
+	}
+	return nil
+}
+
+// report prints every example that failed and a summary of all runs to w.
+// It reports the number of failed examples,
+// where each package that failed to run counts as one.
+func (v *exampleVerifier) report(w io.Writer) (numFailed int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var impPaths []string
+	for impPath := range v.runs {
+		impPaths = append(impPaths, impPath)
+	}
+	sort.Strings(impPaths)
+
+	var numPassed int
+	for _, impPath := range impPaths {
+		run := v.runs[impPath]
+		if run.err != "" {
+			fmt.Fprintf(w, "--- FAIL: %s: unable to run examples\n%s\n", impPath, indent(run.err))
+			numFailed++
+			continue
+		}
+		var names []string
+		for name := range run.results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if r := run.results[name]; r.Passed {
+				numPassed++
+			} else {
+				fmt.Fprintf(w, "--- FAIL: %s.%s\n%s\n", impPath, name, indent(r.Output))
+				numFailed++
+			}
+		}
+	}
+	fmt.Fprintf(w, "verified examples in %d packages: %d passed, %d failed\n", len(impPaths), numPassed, numFailed)
+	return numFailed
+}
+
+// indent indents every line of s with a tab.
+func indent(s string) string {
+	return "\t" + strings.ReplaceAll(s, "\n", "\n\t")
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTestEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      string // output of "go test -json" (without times)
+		wantResults map[string]exampleResult
+		wantOutput  string
+	}{{
+		name: "Pass",
+		events: `
+{"Action":"start","Package":"example.com/p"}
+{"Action":"run","Package":"example.com/p","Test":"ExampleHello"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"=== RUN   ExampleHello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"--- PASS: ExampleHello (0.00s)\n"}
+{"Action":"pass","Package":"example.com/p","Test":"ExampleHello","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Output":"PASS\n"}
+{"Action":"output","Package":"example.com/p","Output":"ok  \texample.com/p\t0.003s\n"}
+{"Action":"pass","Package":"example.com/p","Elapsed":0.004}
+`,
+		wantResults: map[string]exampleResult{
+			"ExampleHello": {Passed: true},
+		},
+		wantOutput: "PASS\nok  \texample.com/p\t0.003s\n",
+	}, {
+		name: "SomeFail",
+		events: `
+{"Action":"start","Package":"example.com/p"}
+{"Action":"run","Package":"example.com/p","Test":"ExampleHello"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"=== RUN   ExampleHello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"--- PASS: ExampleHello (0.00s)\n"}
+{"Action":"pass","Package":"example.com/p","Test":"ExampleHello","Elapsed":0}
+{"Action":"run","Package":"example.com/p","Test":"ExampleHello_fail"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"=== RUN   ExampleHello_fail\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"--- FAIL: ExampleHello_fail (0.00s)\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"got:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"hello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"want:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"goodbye\n"}
+{"Action":"fail","Package":"example.com/p","Test":"ExampleHello_fail","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\n"}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\texample.com/p\t0.002s\n"}
+{"Action":"fail","Package":"example.com/p","Elapsed":0.002}
+`,
+		wantResults: map[string]exampleResult{
+			"ExampleHello":      {Passed: true},
+			"ExampleHello_fail": {Output: "got:\nhello\nwant:\ngoodbye"},
+		},
+		wantOutput: "FAIL\nFAIL\texample.com/p\t0.002s\n",
+	}, {
+		name: "AllFail",
+		events: `
+{"Action":"start","Package":"example.com/p"}
+{"Action":"run","Package":"example.com/p","Test":"ExampleHello"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"=== RUN   ExampleHello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"--- FAIL: ExampleHello (0.00s)\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"got:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"hello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"want:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello","Output":"hi\n"}
+{"Action":"fail","Package":"example.com/p","Test":"ExampleHello","Elapsed":0}
+{"Action":"run","Package":"example.com/p","Test":"ExampleHello_fail"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"=== RUN   ExampleHello_fail\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"--- FAIL: ExampleHello_fail (0.00s)\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"got:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"hello\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"want:\n"}
+{"Action":"output","Package":"example.com/p","Test":"ExampleHello_fail","Output":"goodbye\n"}
+{"Action":"fail","Package":"example.com/p","Test":"ExampleHello_fail","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\n"}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\texample.com/p\t0.002s\n"}
+{"Action":"fail","Package":"example.com/p","Elapsed":0.002}
+`,
+		wantResults: map[string]exampleResult{
+			"ExampleHello":      {Output: "got:\nhello\nwant:\nhi"},
+			"ExampleHello_fail": {Output: "got:\nhello\nwant:\ngoodbye"},
+		},
+		wantOutput: "FAIL\nFAIL\texample.com/p\t0.002s\n",
+	}, {
+		name: "BuildFailure",
+		events: `
+{"ImportPath":"example.com/p","Action":"build-output","Output":"# example.com/p\n"}
+{"ImportPath":"example.com/p","Action":"build-output","Output":"./p.go:4:17: undefined: undefined\n"}
+{"ImportPath":"example.com/p","Action":"build-fail"}
+{"Action":"start","Package":"example.com/p"}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\texample.com/p [build failed]\n"}
+{"Action":"fail","Package":"example.com/p","Elapsed":0,"FailedBuild":"example.com/p"}
+`,
+		wantResults: map[string]exampleResult{},
+		wantOutput:  "# example.com/p\n./p.go:4:17: undefined: undefined\nFAIL\texample.com/p [build failed]\n",
+	}, {
+		// Before Go 1.24, build errors are only written to stderr.
+		name: "BuildFailureStderr",
+		events: `
+{"Action":"output","Package":"example.com/p","Output":"FAIL\texample.com/p [build failed]\n"}
+{"Action":"fail","Package":"example.com/p","Elapsed":0}
+`,
+		wantResults: map[string]exampleResult{},
+		wantOutput:  "FAIL\texample.com/p [build failed]\n",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResults, gotOutput := parseTestEvents(strings.NewReader(tt.events))
+			if diff := cmp.Diff(tt.wantResults, gotResults); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+			if gotOutput != tt.wantOutput {
+				t.Errorf("package output:\ngot  %q\nwant %q", gotOutput, tt.wantOutput)
+			}
+		})
+	}
+}
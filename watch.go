@@ -0,0 +1,242 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watcher polls the source files of the main modules for changes and
+// incrementally reloads the packages in directories that have changed.
+type watcher struct {
+	patterns []string
+	bctxs    []buildContext
+
+	// files is the fingerprint of every watched file.
+	// It is only accessed by the polling goroutine.
+	files map[string]string
+
+	// full reports whether the next reload must reload every package,
+	// which is the case if the previous load failed.
+	full bool
+
+	mu      sync.Mutex
+	cfg     *renderConfig // replaced whenever the package tree is reloaded
+	changed chan struct{} // closed whenever the package tree is reloaded
+}
+
+// newWatcher returns a watcher for the packages in cfg.root,
+// which were loaded from the patterns for every build context.
+// If loadFailed is set, then the first change reloads every package.
+func newWatcher(cfg *renderConfig, patterns []string, bctxs []buildContext, loadFailed bool) *watcher {
+	w := &watcher{
+		patterns: patterns,
+		bctxs:    bctxs,
+		full:     loadFailed,
+		cfg:      cfg,
+		changed:  make(chan struct{}),
+	}
+	w.files = w.scan()
+	return w
+}
+
+// config returns the render configuration for the current package tree.
+func (w *watcher) config() *renderConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cfg
+}
+
+// changes returns a channel that is closed when the package tree is reloaded.
+func (w *watcher) changes() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+// run polls for changes at the specified interval forever.
+func (w *watcher) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		w.poll()
+	}
+}
+
+// poll reloads the package tree if any watched file has changed.
+func (w *watcher) poll() {
+	files := w.scan()
+	dirs := make(map[string]bool)
+	full := w.full
+	for _, file := range diffFiles(w.files, files) {
+		dirs[filepath.Dir(file)] = true
+		switch filepath.Base(file) {
+		case "go.mod", "go.sum", "go.work":
+			full = true // dependencies may have changed
+		}
+	}
+	w.files = files
+	if len(dirs) == 0 {
+		return
+	}
+
+	var root *packageInfo
+	var err error
+	if full {
+		log.Printf("reloading all packages")
+		root, err = loadPackages(w.patterns, w.bctxs)
+	} else {
+		var changed []string
+		for dir := range dirs {
+			changed = append(changed, dir)
+		}
+		sort.Strings(changed)
+		log.Printf("reloading packages in %v", strings.Join(changed, ", "))
+		root, err = w.reload(changed)
+	}
+	w.full = err != nil
+	if err != nil {
+		log.Printf("unable to reload packages: %v", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cfg := *w.cfg
+	cfg.root = root
+	w.cfg = &cfg
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// reload returns a copy of the current package tree where the packages
+// in the specified directories (and any new dependencies) are reloaded.
+func (w *watcher) reload(dirs []string) (*packageInfo, error) {
+	changed := make(map[string]bool)
+	for _, dir := range dirs {
+		changed[dir] = true
+	}
+
+	// Remove the packages in the changed directories,
+	// remembering whether they were only loaded as a dependency.
+	depOnly := make(map[string]bool)
+	root := w.config().root.clone()
+	root.prune(func(pkg *packageInfo) bool {
+		if changed[pkg.dirPath] {
+			depOnly[pkg.dirPath] = pkg.depOnly
+			return true
+		}
+		return false
+	})
+
+	// Reload the packages in the changed directories that still exist.
+	var patterns []string
+	for _, dir := range dirs {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			patterns = append(patterns, dir)
+		}
+	}
+	if len(patterns) == 0 {
+		return root, nil
+	}
+	loaded, err := loadPackages(patterns, w.bctxs)
+	if err != nil {
+		return nil, err
+	}
+	loaded.walk(func(pkg *packageInfo) bool {
+		if pkg.dirPath == "" {
+			return true
+		}
+		if prev := root.resolve(pkg.impPath); prev != nil && prev.dirPath != "" {
+			return true // already loaded and unchanged
+		}
+		if changed[pkg.dirPath] {
+			// New packages are assumed to be requested
+			// if they belong to a main module.
+			var ok bool
+			if pkg.depOnly, ok = depOnly[pkg.dirPath]; !ok {
+				pkg.depOnly = pkg.module == nil || !pkg.module.Main
+			}
+		}
+		root.merge(pkg)
+		return true
+	})
+	return root, nil
+}
+
+// scan returns a fingerprint of every Go source file and module file
+// in the directories of the main modules, excluding nested modules.
+// If no main module is known, it scans the current directory.
+func (w *watcher) scan() map[string]string {
+	var roots []string
+	seen := make(map[string]bool)
+	w.config().root.walk(func(pkg *packageInfo) bool {
+		if m := pkg.module; m != nil && m.Main && m.Dir != "" && !seen[m.Dir] {
+			seen[m.Dir] = true
+			roots = append(roots, m.Dir)
+		}
+		return true
+	})
+	if len(roots) == 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil
+		}
+		roots = append(roots, wd)
+	}
+
+	files := make(map[string]string)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // ignore unreadable files
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if path == root {
+					return nil
+				}
+				switch {
+				case strings.HasPrefix(name, "."), strings.HasPrefix(name, "_"), name == "testdata", name == "vendor":
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir // nested module
+				}
+				return nil
+			}
+			switch {
+			case strings.HasSuffix(name, ".go"), name == "go.mod", name == "go.sum", name == "go.work":
+				if fi, err := d.Info(); err == nil {
+					files[path] = fmt.Sprintf("%d:%d", fi.ModTime().UnixNano(), fi.Size())
+				}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// diffFiles returns the files that were added, removed, or modified.
+func diffFiles(prev, next map[string]string) []string {
+	var diff []string
+	for file, fp := range next {
+		if prev[file] != fp {
+			diff = append(diff, file)
+		}
+	}
+	for file := range prev {
+		if _, ok := next[file]; !ok {
+			diff = append(diff, file)
+		}
+	}
+	return diff
+}
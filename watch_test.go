@@ -0,0 +1,262 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffFiles(t *testing.T) {
+	tests := []struct {
+		prev, next map[string]string
+		want       []string
+	}{{
+		prev: nil,
+		next: nil,
+		want: nil,
+	}, {
+		prev: map[string]string{"a.go": "1:10"},
+		next: map[string]string{"a.go": "1:10"},
+		want: nil,
+	}, {
+		prev: nil,
+		next: map[string]string{"a.go": "1:10", "b.go": "1:20"},
+		want: []string{"a.go", "b.go"},
+	}, {
+		prev: map[string]string{"a.go": "1:10", "b.go": "1:20"},
+		next: nil,
+		want: []string{"a.go", "b.go"},
+	}, {
+		prev: map[string]string{"a.go": "1:10", "b.go": "1:20", "c.go": "1:30"},
+		next: map[string]string{"a.go": "1:10", "b.go": "2:20", "d.go": "1:40"},
+		want: []string{"b.go", "c.go", "d.go"},
+	}}
+	for i, tt := range tests {
+		got := diffFiles(tt.prev, tt.next)
+		sort.Strings(got)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("test %d, diffFiles mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestPruneClone(t *testing.T) {
+	root := new(packageInfo)
+	for _, pkg := range []*packageInfo{
+		{impPath: "example.com/m", dirPath: "/m"},
+		{impPath: "example.com/m/a", dirPath: "/m/a"},
+		{impPath: "example.com/m/a/b", dirPath: "/m/a/b"},
+		{impPath: "example.com/m/c/d", dirPath: "/m/c/d"},
+		{impPath: "example.com/m/e", err: "no Go files"},
+		{impPath: "io", dirPath: "/go/src/io", depOnly: true},
+	} {
+		root.merge(pkg)
+	}
+	packages := func(root *packageInfo) (impPaths []string) {
+		root.walk(func(pkg *packageInfo) bool {
+			if pkg.dirPath != "" || pkg.err != "" {
+				impPaths = append(impPaths, pkg.impPath)
+			}
+			return true
+		})
+		return impPaths
+	}
+	dirs := func(root *packageInfo) (impPaths []string) {
+		root.walk(func(pkg *packageInfo) bool {
+			impPaths = append(impPaths, pkg.impPath)
+			return true
+		})
+		return impPaths
+	}
+	all := []string{"example.com/m", "example.com/m/a", "example.com/m/a/b", "example.com/m/c/d", "example.com/m/e", "io"}
+
+	tests := []struct {
+		drop         map[string]bool // directories of the packages to drop
+		wantPackages []string
+		wantDirs     []string
+	}{{
+		drop:         nil,
+		wantPackages: all,
+		wantDirs:     []string{"", "example.com", "example.com/m", "example.com/m/a", "example.com/m/a/b", "example.com/m/c", "example.com/m/c/d", "example.com/m/e", "io"},
+	}, {
+		// Parent directories are kept for the remaining packages.
+		drop:         map[string]bool{"/m": true, "/m/a": true},
+		wantPackages: []string{"example.com/m/a/b", "example.com/m/c/d", "example.com/m/e", "io"},
+		wantDirs:     []string{"", "example.com", "example.com/m", "example.com/m/a", "example.com/m/a/b", "example.com/m/c", "example.com/m/c/d", "example.com/m/e", "io"},
+	}, {
+		// Directories left without packages are removed.
+		drop:         map[string]bool{"/m/a/b": true, "/m/c/d": true, "/go/src/io": true},
+		wantPackages: []string{"example.com/m", "example.com/m/a", "example.com/m/e"},
+		wantDirs:     []string{"", "example.com", "example.com/m", "example.com/m/a", "example.com/m/e"},
+	}, {
+		// Packages that failed to load without a directory are not dropped.
+		drop:         map[string]bool{"/m": true, "/m/a": true, "/m/a/b": true, "/m/c/d": true, "/go/src/io": true},
+		wantPackages: []string{"example.com/m/e"},
+		wantDirs:     []string{"", "example.com", "example.com/m", "example.com/m/e"},
+	}}
+	for i, tt := range tests {
+		clone := root.clone()
+		if clone.prune(func(pkg *packageInfo) bool { return tt.drop[pkg.dirPath] }) {
+			t.Errorf("test %d, prune = true, want false", i)
+		}
+		if diff := cmp.Diff(tt.wantPackages, packages(clone)); diff != "" {
+			t.Errorf("test %d, pruned packages mismatch (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(tt.wantDirs, dirs(clone)); diff != "" {
+			t.Errorf("test %d, pruned directories mismatch (-want +got):\n%s", i, diff)
+		}
+
+		// Pruning the clone must not modify the original tree.
+		if diff := cmp.Diff(all, packages(root)); diff != "" {
+			t.Errorf("test %d, original packages mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	// Pruning every package leaves an empty tree.
+	root = new(packageInfo)
+	root.merge(&packageInfo{impPath: "example.com/m/a", dirPath: "/m/a"})
+	if !root.prune(func(*packageInfo) bool { return true }) {
+		t.Errorf("prune of every package = false, want true")
+	}
+	if got := dirs(root); !cmp.Equal(got, []string{""}) {
+		t.Errorf("pruned directories = %q, want only the root", got)
+	}
+}
+
+func TestWatcherScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"go.mod",
+		"go.sum",
+		"a.go",
+		"a_test.go",
+		"README.md",
+		"sub/b.go",
+		"testdata/c.go",
+		"vendor/example.com/v/v.go",
+		".git/d.go",
+		"_build/e.go",
+		"nested/go.mod",
+		"nested/f.go",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := new(packageInfo)
+	root.merge(&packageInfo{
+		impPath: "example.com/m",
+		dirPath: dir,
+		module:  &moduleInfo{Path: "example.com/m", Dir: dir, Main: true},
+	})
+	w := newWatcher(&renderConfig{root: root}, nil, nil, false)
+	var got []string
+	for file := range w.files {
+		rel, _ := filepath.Rel(dir, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{"a.go", "a_test.go", "go.mod", "go.sum", "sub/b.go"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("scanned files mismatch (-want +got):\n%s", diff)
+	}
+
+	// Modifying, adding, and removing files is detected.
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package m\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "g.go"), nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "go.sum")); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, file := range diffFiles(w.files, w.scan()) {
+		rel, _ := filepath.Rel(dir, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want = []string{"a.go", "go.sum", "sub/g.go"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("changed files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	writeFile := func(name, data string) {
+		t.Helper()
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("go.mod", "module example.com/m\n\ngo 1.16\n")
+	writeFile("a/a.go", "package a\n\nimport _ \"io\"\n")
+	writeFile("b/b.go", "package b\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	bctxs := []buildContext{{}}
+	root, err := loadPackages([]string{"./..."}, bctxs)
+	if err != nil {
+		t.Fatalf("loadPackages error: %v", err)
+	}
+	w := newWatcher(&renderConfig{root: root}, []string{"./..."}, bctxs, false)
+
+	// Add a package, modify a package, and remove a package.
+	writeFile("c/c.go", "package c\n")
+	writeFile("a/a.go", "package a\n\nimport _ \"errors\"\n")
+	if err := os.RemoveAll(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	w.poll()
+
+	var got []string
+	w.config().root.walk(func(pkg *packageInfo) bool {
+		if pkg.dirPath != "" && !pkg.depOnly {
+			got = append(got, pkg.impPath)
+		}
+		return true
+	})
+	want := []string{"example.com/m/a", "example.com/m/c"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("reloaded packages mismatch (-want +got):\n%s", diff)
+	}
+	if pkg := w.config().root.resolve("example.com/m/a"); pkg == nil || !cmp.Equal(pkg.imports, []string{"errors"}) {
+		t.Errorf("reloaded package example.com/m/a does not import errors")
+	}
+	if pkg := w.config().root.resolve("errors"); pkg == nil || !pkg.depOnly {
+		t.Errorf("new dependency errors is not loaded as a dependency")
+	}
+	if pkg := root.resolve("example.com/m/b"); pkg == nil || pkg.dirPath == "" {
+		t.Errorf("reload modified the previous package tree")
+	}
+}